@@ -0,0 +1,118 @@
+package variant
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// Implemented by stats which can discard their accumulated values
+type resetter interface {
+	Reset()
+}
+
+// Implemented by stats whose window size can change
+type resizer interface {
+	Resize(size int)
+}
+
+// Implemented by stats whose reported percentile can change
+type percentileSetter interface {
+	SetPercentile(percentile float64)
+}
+
+// AdminHandler lets operators act on published stats at runtime, for
+// instance to clear a window poisoned by a bad deploy without a
+// restart:
+//
+//	POST /debug/variant/admin?name=db.latency&action=reset
+//	POST /debug/variant/admin?name=db.latency&action=resize&size=500
+//	POST /debug/variant/admin?name=db.latency&action=percentile&p=0.999
+//	POST /debug/variant/admin?name=db.poll&action=pause
+//	POST /debug/variant/admin?name=db.poll&action=resume
+//
+// The handler refuses every request unless Authorize is set and
+// approves it.
+type AdminHandler struct {
+	// decides whether a request may change stats
+	Authorize func(r *http.Request) bool
+	// samplers which may be paused and resumed, by name
+	Samplers map[string]*Sampler
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Authorize == nil || !h.Authorize(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	name := query.Get("name")
+	switch action := query.Get("action"); action {
+	case "pause", "resume":
+		s, ok := h.Samplers[name]
+		if !ok {
+			http.Error(w, "no such sampler", http.StatusNotFound)
+			return
+		}
+		if action == "pause" {
+			s.Pause()
+		} else {
+			s.Resume()
+		}
+	case "reset":
+		v := Get(name)
+		if v == nil {
+			http.Error(w, "no such stat", http.StatusNotFound)
+			return
+		}
+		rs, ok := v.(resetter)
+		if !ok {
+			http.Error(w, "stat cannot be reset", http.StatusBadRequest)
+			return
+		}
+		rs.Reset()
+	case "resize":
+		v := Get(name)
+		if v == nil {
+			http.Error(w, "no such stat", http.StatusNotFound)
+			return
+		}
+		rs, ok := v.(resizer)
+		if !ok {
+			http.Error(w, "stat cannot be resized", http.StatusBadRequest)
+			return
+		}
+		size, err := strconv.Atoi(query.Get("size"))
+		if err != nil || size < 1 {
+			http.Error(w, "size must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		rs.Resize(size)
+	case "percentile":
+		v := Get(name)
+		if v == nil {
+			http.Error(w, "no such stat", http.StatusNotFound)
+			return
+		}
+		ps, ok := v.(percentileSetter)
+		if !ok {
+			http.Error(w, "stat has no percentile", http.StatusBadRequest)
+			return
+		}
+		p, err := strconv.ParseFloat(query.Get("p"), 64)
+		if err != nil || !(p >= 0 && p <= 1) {
+			http.Error(w, "p must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		ps.SetPercentile(p)
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,106 @@
+package variant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func admin(h *AdminHandler, query string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/debug/variant/admin?"+query, nil))
+	return rec
+}
+
+func TestAdminDisabledByDefault(t *testing.T) {
+	if rec := admin(new(AdminHandler), "name=x&action=reset"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestAdminReset(t *testing.T) {
+	unregisterAfter(t, "test.admin.reset")
+	s := NewSimpleMovingAverage("test.admin.reset", 3)
+	s.Update(1)
+	rec := admin(&AdminHandler{Authorize: allowAll}, "name=test.admin.reset&action=reset")
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if n := len(s.Values()); n != 0 {
+		t.Errorf("expected empty window, got %d values", n)
+	}
+}
+
+func TestAdminResize(t *testing.T) {
+	unregisterAfter(t, "test.admin.resize")
+	s := NewSimpleMovingAverage("test.admin.resize", 3)
+	s.Update(1)
+	s.Update(2)
+	s.Update(3)
+	h := &AdminHandler{Authorize: allowAll}
+	if rec := admin(h, "name=test.admin.resize&action=resize&size=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+	if rec := admin(h, "name=test.admin.resize&action=resize&size=2"); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if avg := s.Value(); avg != 2.5 {
+		t.Errorf("expected avg of 2.5, got %f", avg)
+	}
+}
+
+func TestAdminPauseSampler(t *testing.T) {
+	sma := NewSimpleMovingAverage("", 10)
+	sampler := NewSampler(func() float64 { return 1 }, sma, time.Hour)
+	defer sampler.Stop()
+
+	h := &AdminHandler{Authorize: allowAll, Samplers: map[string]*Sampler{"poll": sampler}}
+	if rec := admin(h, "name=poll&action=pause"); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if !sampler.paused.Load() {
+		t.Errorf("expected sampler to be paused")
+	}
+	admin(h, "name=poll&action=resume")
+	if sampler.paused.Load() {
+		t.Errorf("expected sampler to be resumed")
+	}
+	if rec := admin(h, "name=other&action=pause"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestAdminPercentile(t *testing.T) {
+	unregisterAfter(t, "test.admin.percentile")
+	s := NewSimpleMovingPercentile("test.admin.percentile", 0.5, 10)
+	for i := 1; i <= 10; i++ {
+		s.Update(float64(i))
+	}
+	h := &AdminHandler{Authorize: allowAll}
+	if rec := admin(h, "name=test.admin.percentile&action=percentile&p=2"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+	if rec := admin(h, "name=test.admin.percentile&action=percentile&p=0.1"); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if v := s.Value(); v != 2.0 {
+		t.Errorf("expected 10th percentile of 2.0, got %f", v)
+	}
+}
+
+func TestAdminPercentileBounds(t *testing.T) {
+	unregisterAfter(t, "test.admin.bounds")
+	s := NewSimpleMovingPercentile("test.admin.bounds", 0.5, 10)
+	s.Update(1)
+	h := &AdminHandler{Authorize: allowAll}
+	if rec := admin(h, "name=test.admin.bounds&action=percentile&p=NaN"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for NaN, got %d", rec.Code)
+	}
+	if rec := admin(h, "name=test.admin.bounds&action=percentile&p=1"); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if st := s.String(); st != "1.000000" {
+		t.Errorf("expected 1.000000, got %s", st)
+	}
+}
@@ -0,0 +1,527 @@
+package variant
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How an AgentX entry's value is presented to SNMP managers
+type SNMPType int
+
+const (
+	// an unsigned 32 bit value, rounded and clamped
+	SNMPGauge32 SNMPType = iota
+	// an unsigned 64 bit counter, rounded and clamped
+	SNMPCounter64
+	// a signed 32 bit integer, rounded and clamped
+	SNMPInteger
+	// the value rendered as text, the only way to keep fractions
+	SNMPOctetString
+)
+
+// maps one numeric stat to an OID
+type SNMPEntry struct {
+	// the full object identifier, e.g. "1.3.6.1.4.1.99999.1.1.0";
+	// it must lie under the agent's Subtree
+	OID string
+	// what the entry holds
+	Type SNMPType
+	// reads the current value, e.g. a Gauge's Value method
+	Value func() float64
+}
+
+// AgentX is a minimal SNMP sub-agent (RFC 2741) exposing selected
+// stats to a master agent such as net-snmp's snmpd, for environments
+// which can only poll SNMP. It registers one subtree and answers Get,
+// GetNext, and GetBulk requests from a read-only table; sets are
+// refused.
+type AgentX struct {
+	// the subtree registered with the master, e.g.
+	// "1.3.6.1.4.1.99999.1"
+	Subtree string
+	// the stats to expose
+	Entries []SNMPEntry
+	// sent to the master when opening the session
+	Description string
+	// how long the master should wait for answers; one second if zero
+	Timeout time.Duration
+}
+
+// AgentX PDU types and the parts of the protocol this agent uses
+const (
+	agentxOpen     = 1
+	agentxClose    = 2
+	agentxRegister = 3
+	agentxGet      = 5
+	agentxGetNext  = 6
+	agentxGetBulk  = 7
+	agentxTestSet  = 8
+	agentxResponse = 18
+
+	agentxNetworkByteOrder = 0x10
+
+	agentxInteger        = 2
+	agentxOctetString    = 4
+	agentxGauge32        = 66
+	agentxCounter64      = 70
+	agentxNoSuchObject   = 128
+	agentxEndOfMibView   = 130
+	agentxNotWritable    = 17
+	agentxCloseShutdown  = 5
+	agentxHeaderSize     = 20
+	agentxMaxPayloadSize = 1 << 20
+)
+
+// returned when the master answers Open or Register with an error
+var errAgentXRefused = errors.New("variant: agentx master refused the request")
+
+// Connect to a master agent, e.g. DialAndServe(ctx, "tcp",
+// "localhost:705") or ("unix", "/var/agentx/master"), and answer its
+// requests until `ctx` is done or the connection fails.
+func (a *AgentX) DialAndServe(ctx context.Context, network, addr string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return err
+	}
+	return a.Serve(ctx, conn)
+}
+
+// Open a session over `conn`, register the subtree, and answer
+// requests until `ctx` is done or the connection fails. The
+// connection is closed when Serve returns.
+func (a *AgentX) Serve(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+
+	table, err := a.table()
+	if err != nil {
+		return err
+	}
+	subtree, err := parseOID(a.Subtree)
+	if err != nil {
+		return err
+	}
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	timeoutSecs := byte(min(int(timeout/time.Second), 255))
+	if timeoutSecs == 0 {
+		timeoutSecs = 1
+	}
+
+	s := &agentxSession{conn: conn, order: binary.BigEndian, started: time.Now()}
+	stop := context.AfterFunc(ctx, func() {
+		s.mutex.Lock()
+		id := s.id
+		s.mutex.Unlock()
+		s.send(&agentxPDU{typ: agentxClose, session: id, payload: []byte{agentxCloseShutdown, 0, 0, 0}})
+		conn.Close()
+	})
+	defer stop()
+
+	open := new(bytes.Buffer)
+	open.Write([]byte{timeoutSecs, 0, 0, 0})
+	writeOID(open, s.order, nil, false)
+	writeOctetString(open, s.order, []byte(a.Description))
+	resp, err := s.call(&agentxPDU{typ: agentxOpen, payload: open.Bytes()})
+	if err != nil {
+		return ctxErr(ctx, err)
+	}
+	s.mutex.Lock()
+	s.id = resp.session
+	s.mutex.Unlock()
+
+	register := new(bytes.Buffer)
+	register.Write([]byte{timeoutSecs, 127, 0, 0})
+	writeOID(register, s.order, subtree, false)
+	if _, err := s.call(&agentxPDU{typ: agentxRegister, session: s.id, payload: register.Bytes()}); err != nil {
+		return ctxErr(ctx, err)
+	}
+
+	for {
+		req, err := readPDU(conn)
+		if err != nil {
+			return ctxErr(ctx, err)
+		}
+		if out := s.answer(req, table); out != nil {
+			if err := s.send(out); err != nil {
+				return ctxErr(ctx, err)
+			}
+		}
+	}
+}
+
+// prefer the context's error when the connection failed because it
+// was closed on cancellation
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// a table entry with its OID parsed
+type agentxEntry struct {
+	oid []uint32
+	SNMPEntry
+}
+
+// the entries, parsed and sorted by OID
+func (a *AgentX) table() ([]agentxEntry, error) {
+	subtree, err := parseOID(a.Subtree)
+	if err != nil {
+		return nil, err
+	}
+	table := make([]agentxEntry, 0, len(a.Entries))
+	for _, e := range a.Entries {
+		oid, err := parseOID(e.OID)
+		if err != nil {
+			return nil, err
+		}
+		if len(oid) <= len(subtree) || compareOID(oid[:len(subtree)], subtree) != 0 {
+			return nil, fmt.Errorf("variant: OID %s is not under subtree %s", e.OID, a.Subtree)
+		}
+		table = append(table, agentxEntry{oid, e})
+	}
+	sort.Slice(table, func(i, j int) bool {
+		return compareOID(table[i].oid, table[j].oid) < 0
+	})
+	return table, nil
+}
+
+// one AgentX session with a master
+type agentxSession struct {
+	mutex   sync.Mutex
+	conn    net.Conn
+	order   binary.ByteOrder
+	id      uint32
+	packet  uint32
+	started time.Time
+}
+
+// a decoded AgentX PDU
+type agentxPDU struct {
+	typ         byte
+	flags       byte
+	session     uint32
+	transaction uint32
+	packet      uint32
+	payload     []byte
+}
+
+// the byte order the PDU's payload is encoded in
+func (p *agentxPDU) order() binary.ByteOrder {
+	if p.flags&agentxNetworkByteOrder != 0 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+func (s *agentxSession) send(p *agentxPDU) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	hdr := make([]byte, agentxHeaderSize)
+	hdr[0] = 1
+	hdr[1] = p.typ
+	hdr[2] = agentxNetworkByteOrder
+	s.order.PutUint32(hdr[4:], p.session)
+	s.order.PutUint32(hdr[8:], p.transaction)
+	s.order.PutUint32(hdr[12:], p.packet)
+	s.order.PutUint32(hdr[16:], uint32(len(p.payload)))
+	_, err := s.conn.Write(append(hdr, p.payload...))
+	return err
+}
+
+// send a request and wait for its response, failing if the master
+// reports an error
+func (s *agentxSession) call(p *agentxPDU) (*agentxPDU, error) {
+	s.packet++
+	p.packet = s.packet
+	if err := s.send(p); err != nil {
+		return nil, err
+	}
+	for {
+		resp, err := readPDU(s.conn)
+		if err != nil {
+			return nil, err
+		}
+		if resp.typ != agentxResponse || resp.packet != p.packet {
+			continue
+		}
+		if len(resp.payload) < 8 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if code := resp.order().Uint16(resp.payload[4:]); code != 0 {
+			return nil, fmt.Errorf("%w (error %d)", errAgentXRefused, code)
+		}
+		return resp, nil
+	}
+}
+
+func readPDU(r io.Reader) (*agentxPDU, error) {
+	hdr := make([]byte, agentxHeaderSize)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+	p := &agentxPDU{typ: hdr[1], flags: hdr[2]}
+	order := p.order()
+	p.session = order.Uint32(hdr[4:])
+	p.transaction = order.Uint32(hdr[8:])
+	p.packet = order.Uint32(hdr[12:])
+	n := order.Uint32(hdr[16:])
+	if n > agentxMaxPayloadSize {
+		return nil, fmt.Errorf("variant: agentx payload of %d bytes is too large", n)
+	}
+	p.payload = make([]byte, n)
+	if _, err := io.ReadFull(r, p.payload); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// the response to a request from the master, or nil if none is due
+func (s *agentxSession) answer(req *agentxPDU, table []agentxEntry) *agentxPDU {
+	order := req.order()
+	body := req.payload
+	if req.flags&0x08 != 0 { // NON_DEFAULT_CONTEXT
+		if _, rest, err := readOctetString(body, order); err == nil {
+			body = rest
+		}
+	}
+
+	var errCode, errIndex uint16
+	vars := new(bytes.Buffer)
+	switch req.typ {
+	case agentxGet, agentxGetNext:
+		for len(body) > 0 {
+			start, include, end, rest, err := readSearchRange(body, order)
+			if err != nil {
+				break
+			}
+			body = rest
+			if req.typ == agentxGet {
+				s.writeGet(vars, table, start)
+			} else {
+				s.writeNext(vars, table, start, include, end)
+			}
+		}
+	case agentxGetBulk:
+		if len(body) < 4 {
+			break
+		}
+		nonRepeaters := int(order.Uint16(body))
+		repetitions := int(order.Uint16(body[2:]))
+		body = body[4:]
+		for i := 0; len(body) > 0; i++ {
+			start, include, end, rest, err := readSearchRange(body, order)
+			if err != nil {
+				break
+			}
+			body = rest
+			n := repetitions
+			if i < nonRepeaters {
+				n = 1
+			}
+			for j := 0; j < n; j++ {
+				next := s.writeNext(vars, table, start, include, end)
+				if next == nil {
+					break
+				}
+				start, include = next, false
+			}
+		}
+	case agentxTestSet:
+		errCode, errIndex = agentxNotWritable, 1
+	default:
+		// nothing to say to Close, or to the rest of a set
+		return nil
+	}
+
+	payload := new(bytes.Buffer)
+	hdr := make([]byte, 8)
+	s.order.PutUint32(hdr, uint32(time.Since(s.started)/(10*time.Millisecond)))
+	s.order.PutUint16(hdr[4:], errCode)
+	s.order.PutUint16(hdr[6:], errIndex)
+	payload.Write(hdr)
+	payload.Write(vars.Bytes())
+	return &agentxPDU{
+		typ:         agentxResponse,
+		session:     req.session,
+		transaction: req.transaction,
+		packet:      req.packet,
+		payload:     payload.Bytes(),
+	}
+}
+
+// write the varbind answering a Get for `oid`
+func (s *agentxSession) writeGet(w *bytes.Buffer, table []agentxEntry, oid []uint32) {
+	i := sort.Search(len(table), func(i int) bool {
+		return compareOID(table[i].oid, oid) >= 0
+	})
+	if i < len(table) && compareOID(table[i].oid, oid) == 0 {
+		s.writeValue(w, table[i])
+		return
+	}
+	writeVarBindHeader(w, s.order, agentxNoSuchObject, oid)
+}
+
+// write the varbind answering a GetNext from `start`, returning the
+// OID answered or nil at the end of the range
+func (s *agentxSession) writeNext(w *bytes.Buffer, table []agentxEntry, start []uint32, include bool, end []uint32) []uint32 {
+	i := sort.Search(len(table), func(i int) bool {
+		c := compareOID(table[i].oid, start)
+		return c > 0 || (include && c == 0)
+	})
+	if i < len(table) && (len(end) == 0 || compareOID(table[i].oid, end) < 0) {
+		s.writeValue(w, table[i])
+		return table[i].oid
+	}
+	writeVarBindHeader(w, s.order, agentxEndOfMibView, start)
+	return nil
+}
+
+func (s *agentxSession) writeValue(w *bytes.Buffer, e agentxEntry) {
+	v := e.Value()
+	b := make([]byte, 8)
+	switch e.Type {
+	case SNMPCounter64:
+		writeVarBindHeader(w, s.order, agentxCounter64, e.oid)
+		n := uint64(0)
+		if v >= math.MaxUint64 {
+			n = math.MaxUint64
+		} else if v > 0 {
+			n = uint64(math.Round(v))
+		}
+		s.order.PutUint64(b, n)
+		w.Write(b)
+	case SNMPInteger:
+		writeVarBindHeader(w, s.order, agentxInteger, e.oid)
+		s.order.PutUint32(b, uint32(int32(clamp(v, math.MinInt32, math.MaxInt32))))
+		w.Write(b[:4])
+	case SNMPOctetString:
+		writeVarBindHeader(w, s.order, agentxOctetString, e.oid)
+		writeOctetString(w, s.order, []byte(strings.Trim(formatFloat(v), `"`)))
+	default:
+		writeVarBindHeader(w, s.order, agentxGauge32, e.oid)
+		s.order.PutUint32(b, uint32(clamp(v, 0, math.MaxUint32)))
+		w.Write(b[:4])
+	}
+}
+
+// round `v` into [lo, hi], with NaN as zero
+func clamp(v, lo, hi float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return math.Max(lo, math.Min(hi, math.Round(v)))
+}
+
+func writeVarBindHeader(w *bytes.Buffer, order binary.ByteOrder, typ uint16, oid []uint32) {
+	b := make([]byte, 4)
+	order.PutUint16(b, typ)
+	w.Write(b)
+	writeOID(w, order, oid, false)
+}
+
+func writeOID(w *bytes.Buffer, order binary.ByteOrder, oid []uint32, include bool) {
+	inc := byte(0)
+	if include {
+		inc = 1
+	}
+	w.Write([]byte{byte(len(oid)), 0, inc, 0})
+	b := make([]byte, 4)
+	for _, id := range oid {
+		order.PutUint32(b, id)
+		w.Write(b)
+	}
+}
+
+func writeOctetString(w *bytes.Buffer, order binary.ByteOrder, s []byte) {
+	b := make([]byte, 4)
+	order.PutUint32(b, uint32(len(s)))
+	w.Write(b)
+	w.Write(s)
+	w.Write(make([]byte, (4-len(s)%4)%4))
+}
+
+// decode an OID, expanding the 1.3.6.1.<prefix> compression
+func readOID(b []byte, order binary.ByteOrder) (oid []uint32, include bool, rest []byte, err error) {
+	if len(b) < 4 {
+		return nil, false, nil, io.ErrUnexpectedEOF
+	}
+	n, prefix := int(b[0]), b[1]
+	include = b[2] != 0
+	b = b[4:]
+	if len(b) < 4*n {
+		return nil, false, nil, io.ErrUnexpectedEOF
+	}
+	if prefix != 0 {
+		oid = append(oid, 1, 3, 6, 1, uint32(prefix))
+	}
+	for i := 0; i < n; i++ {
+		oid = append(oid, order.Uint32(b[4*i:]))
+	}
+	return oid, include, b[4*n:], nil
+}
+
+func readOctetString(b []byte, order binary.ByteOrder) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	n := int(order.Uint32(b))
+	padded := n + (4-n%4)%4
+	if n < 0 || len(b) < 4+padded {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	return b[4 : 4+n], b[4+padded:], nil
+}
+
+func readSearchRange(b []byte, order binary.ByteOrder) (start []uint32, include bool, end []uint32, rest []byte, err error) {
+	start, include, b, err = readOID(b, order)
+	if err != nil {
+		return
+	}
+	end, _, rest, err = readOID(b, order)
+	return
+}
+
+// parse dotted decimal notation, with or without a leading dot
+func parseOID(s string) ([]uint32, error) {
+	var oid []uint32
+	for _, part := range strings.Split(strings.TrimPrefix(s, "."), ".") {
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("variant: bad OID %q", s)
+		}
+		oid = append(oid, uint32(id))
+	}
+	if len(oid) > 128 {
+		return nil, fmt.Errorf("variant: OID %q is too long", s)
+	}
+	return oid, nil
+}
+
+// order OIDs lexicographically
+func compareOID(a, b []uint32) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,207 @@
+package variant
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// the master's end of a test session, speaking little endian to
+// exercise the agent's byte order handling
+type fakeMaster struct {
+	t      *testing.T
+	conn   net.Conn
+	packet uint32
+}
+
+func (m *fakeMaster) read() *agentxPDU {
+	p, err := readPDU(m.conn)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return p
+}
+
+func (m *fakeMaster) send(typ byte, session uint32, payload []byte) {
+	m.packet++
+	hdr := make([]byte, agentxHeaderSize)
+	hdr[0], hdr[1] = 1, typ
+	binary.LittleEndian.PutUint32(hdr[4:], session)
+	binary.LittleEndian.PutUint32(hdr[12:], m.packet)
+	binary.LittleEndian.PutUint32(hdr[16:], uint32(len(payload)))
+	if _, err := m.conn.Write(append(hdr, payload...)); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+// answer the agent's request with success
+func (m *fakeMaster) ok(req *agentxPDU, session uint32) {
+	hdr := make([]byte, agentxHeaderSize)
+	hdr[0], hdr[1] = 1, agentxResponse
+	binary.LittleEndian.PutUint32(hdr[4:], session)
+	binary.LittleEndian.PutUint32(hdr[12:], req.packet)
+	binary.LittleEndian.PutUint32(hdr[16:], 8)
+	m.conn.Write(append(hdr, make([]byte, 8)...))
+}
+
+// send a request for `ranges` of start and end OIDs, returning the
+// varbinds of the response
+func (m *fakeMaster) request(typ byte, prefix []byte, ranges ...string) []agentxVarBind {
+	body := bytes.NewBuffer(prefix)
+	for i := 0; i < len(ranges); i += 2 {
+		start, _ := parseOID(ranges[i])
+		var end []uint32
+		if ranges[i+1] != "" {
+			end, _ = parseOID(ranges[i+1])
+		}
+		writeOID(body, binary.LittleEndian, start, false)
+		writeOID(body, binary.LittleEndian, end, false)
+	}
+	m.send(typ, 7, body.Bytes())
+	resp := m.read()
+	if resp.typ != agentxResponse || resp.packet != m.packet || resp.session != 7 {
+		m.t.Fatalf("unexpected response %+v", resp)
+	}
+	return decodeVarBinds(m.t, resp)
+}
+
+type agentxVarBind struct {
+	typ   uint16
+	oid   []uint32
+	value []byte
+}
+
+func decodeVarBinds(t *testing.T, resp *agentxPDU) []agentxVarBind {
+	order := resp.order()
+	b := resp.payload[8:]
+	var binds []agentxVarBind
+	for len(b) > 0 {
+		vb := agentxVarBind{typ: order.Uint16(b)}
+		var err error
+		vb.oid, _, b, err = readOID(b[4:], order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch vb.typ {
+		case agentxGauge32, agentxInteger:
+			vb.value, b = b[:4], b[4:]
+		case agentxCounter64:
+			vb.value, b = b[:8], b[8:]
+		case agentxOctetString:
+			vb.value, b, err = readOctetString(b, order)
+		}
+		binds = append(binds, vb)
+	}
+	return binds
+}
+
+func oidString(oid []uint32) string {
+	parts := make([]string, len(oid))
+	for i, id := range oid {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+func TestAgentX(t *testing.T) {
+	depth := NewGauge("")
+	depth.Set(41.6)
+	requests := NewInt("")
+	requests.Add(1 << 40)
+	latency := NewGauge("")
+	latency.Set(0.25)
+
+	agent := &AgentX{
+		Subtree:     "1.3.6.1.4.1.99999.1",
+		Description: "variant test",
+		Entries: []SNMPEntry{
+			{OID: "1.3.6.1.4.1.99999.1.2.0", Type: SNMPCounter64, Value: func() float64 { return float64(requests.Value()) }},
+			{OID: "1.3.6.1.4.1.99999.1.1.0", Type: SNMPGauge32, Value: depth.Value},
+			{OID: "1.3.6.1.4.1.99999.1.3.0", Type: SNMPOctetString, Value: latency.Value},
+		},
+	}
+
+	agentConn, masterConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Serve(ctx, agentConn) }()
+
+	m := &fakeMaster{t: t, conn: masterConn}
+	open := m.read()
+	if open.typ != agentxOpen {
+		t.Fatalf("expected Open, got type %d", open.typ)
+	}
+	m.ok(open, 7)
+	register := m.read()
+	if register.typ != agentxRegister || register.session != 7 {
+		t.Fatalf("expected Register on session 7, got %+v", register)
+	}
+	subtree, _, _, _ := readOID(register.payload[4:], register.order())
+	if s := oidString(subtree); s != "1.3.6.1.4.1.99999.1" {
+		t.Errorf("expected the subtree to be registered, got %s", s)
+	}
+	m.ok(register, 7)
+
+	binds := m.request(agentxGet, nil, "1.3.6.1.4.1.99999.1.1.0", "", "1.3.6.1.4.1.99999.1.9.0", "")
+	if len(binds) != 2 || binds[0].typ != agentxGauge32 || binary.BigEndian.Uint32(binds[0].value) != 42 {
+		t.Fatalf("expected gauge of 42, got %+v", binds)
+	}
+	if binds[1].typ != agentxNoSuchObject {
+		t.Errorf("expected noSuchObject, got %+v", binds[1])
+	}
+
+	binds = m.request(agentxGetNext, nil, "1.3.6.1.4.1.99999.1.1.0", "", "1.3.6.1.4.1.99999.1.3.0", "")
+	if len(binds) != 2 || oidString(binds[0].oid) != "1.3.6.1.4.1.99999.1.2.0" || binary.BigEndian.Uint64(binds[0].value) != 1<<40 {
+		t.Fatalf("expected the counter next, got %+v", binds)
+	}
+	if binds[1].typ != agentxEndOfMibView {
+		t.Errorf("expected endOfMibView, got %+v", binds[1])
+	}
+
+	bulk := []byte{0, 0, 5, 0} // no non-repeaters, five repetitions
+	binds = m.request(agentxGetBulk, bulk, "1.3.6.1.4.1.99999.1", "")
+	if len(binds) != 4 || string(binds[2].value) != "0.250000" || binds[3].typ != agentxEndOfMibView {
+		t.Fatalf("expected a walk of the table, got %+v", binds)
+	}
+
+	m.send(agentxTestSet, 7, nil)
+	if resp := m.read(); resp.order().Uint16(resp.payload[4:]) != agentxNotWritable {
+		t.Errorf("expected sets to be refused")
+	}
+
+	go cancel()
+	if p := m.read(); p.typ != agentxClose {
+		t.Errorf("expected Close on cancel, got type %d", p.typ)
+	}
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestAgentXRejectsForeignOID(t *testing.T) {
+	agent := &AgentX{
+		Subtree: "1.3.6.1.4.1.99999.1",
+		Entries: []SNMPEntry{{OID: "1.3.6.1.2.1.1.0", Value: func() float64 { return 0 }}},
+	}
+	a, b := net.Pipe()
+	defer b.Close()
+	if err := agent.Serve(context.Background(), a); err == nil {
+		t.Errorf("expected an OID outside the subtree to be rejected")
+	}
+}
+
+func TestCompareOID(t *testing.T) {
+	a, _ := parseOID("1.3.6.1.4")
+	b, _ := parseOID(".1.3.6.1.4.1")
+	c, _ := parseOID("1.3.6.2")
+	if compareOID(a, b) >= 0 || compareOID(b, c) >= 0 || compareOID(a, a) != 0 {
+		t.Errorf("unexpected OID ordering")
+	}
+	if _, err := parseOID("1.3.x"); err == nil {
+		t.Errorf("expected a bad OID to be rejected")
+	}
+}
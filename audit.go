@@ -0,0 +1,137 @@
+package variant
+
+import (
+	"expvar"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Implemented by stats which can check their own internal invariants
+type Auditor interface {
+	// describe every broken invariant; nil when all is well
+	Audit() []string
+}
+
+// Audit every published stat which supports it, returning the
+// findings keyed by name. An empty result means everything checked
+// out, so it suits both tests and health checks.
+func Audit() map[string][]string {
+	findings := make(map[string][]string)
+	Do(func(kv expvar.KeyValue) {
+		if a, ok := kv.Value.(Auditor); ok {
+			if problems := a.Audit(); len(problems) > 0 {
+				findings[kv.Key] = problems
+			}
+		}
+	})
+	return findings
+}
+
+// check the window against its size, the published snapshot and the
+// running sum and order tree kept as values enter and leave it
+func (s *SimpleMovingStat) Audit() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var problems []string
+	if n := s.values.Len(); n != s.size {
+		problems = append(problems, fmt.Sprintf("ring holds %d slots, size is %d", n, s.size))
+	}
+	var window []float64
+	s.values.Do(func(val interface{}) {
+		if val != nil {
+			window = append(window, val.(float64))
+		}
+	})
+	problems = append(problems, auditSum(s.sum, window)...)
+	if s.tree != nil {
+		problems = append(problems, auditTree(s.tree, window)...)
+	}
+	snapshot := *s.snapshot.Load()
+	if len(snapshot) > s.size {
+		problems = append(problems, fmt.Sprintf("snapshot holds %d values, size is %d", len(snapshot), s.size))
+	}
+	if !s.dirty.Load() && s.pending == 0 {
+		if len(snapshot) != len(window) {
+			problems = append(problems, fmt.Sprintf("snapshot holds %d values, window holds %d", len(snapshot), len(window)))
+		} else {
+			for i := range window {
+				if snapshot[i] != window[i] && !(math.IsNaN(snapshot[i]) && math.IsNaN(window[i])) {
+					problems = append(problems, fmt.Sprintf("snapshot value %d is %f, window has %f", i, snapshot[i], window[i]))
+					break
+				}
+			}
+		}
+	}
+	if p := math.Float64frombits(s.percentile.Load()); !(p >= 0 && p <= 1) {
+		problems = append(problems, fmt.Sprintf("percentile %f is outside [0, 1]", p))
+	}
+	return problems
+}
+
+// check a running sum against one freshly taken over the window. The
+// sums may differ by rounding, so they only need to agree to within
+// a small fraction of the magnitudes summed.
+func auditSum(sum runningSum, window []float64) []string {
+	var fresh runningSum
+	var magnitude float64
+	for _, val := range window {
+		fresh.add(val)
+		if !math.IsNaN(val) && !math.IsInf(val, 0) {
+			magnitude += math.Abs(val)
+		}
+	}
+	if sum.n != fresh.n {
+		return []string{fmt.Sprintf("running sum counts %d values, window holds %d", sum.n, fresh.n)}
+	}
+	if sum.nan != fresh.nan || sum.posInf != fresh.posInf || sum.negInf != fresh.negInf {
+		return []string{fmt.Sprintf("running sum counts %d NaN, %d +Inf and %d -Inf, window holds %d, %d and %d",
+			sum.nan, sum.posInf, sum.negInf, fresh.nan, fresh.posInf, fresh.negInf)}
+	}
+	if math.Abs(sum.sum-fresh.sum) > 1e-9*math.Max(1, magnitude) {
+		return []string{fmt.Sprintf("running sum is %f, window sums to %f", sum.sum, fresh.sum)}
+	}
+	return nil
+}
+
+// check an order tree holds exactly the values in the window, in
+// sorted order
+func auditTree(tree *orderTree, window []float64) []string {
+	if n := tree.len(); n != len(window) {
+		return []string{fmt.Sprintf("order tree holds %d values, window holds %d", n, len(window))}
+	}
+	sorted := make([]float64, len(window))
+	copy(sorted, window)
+	sort.Float64s(sorted)
+	for i, want := range sorted {
+		got := tree.nth(i)
+		if got != want && !(math.IsNaN(got) && math.IsNaN(want)) {
+			return []string{fmt.Sprintf("order tree value %d is %f, window has %f", i, got, want)}
+		}
+	}
+	return nil
+}
+
+// check the samples are in time order and the total never shrank
+func (r *CounterRate) Audit() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var problems []string
+	if len(r.samples) == 0 {
+		problems = append(problems, "no baseline sample")
+	}
+	for i := 1; i < len(r.samples); i++ {
+		if r.samples[i].at.Before(r.samples[i-1].at) {
+			problems = append(problems, fmt.Sprintf("sample %d is older than sample %d", i, i-1))
+		}
+		if r.samples[i].total < r.samples[i-1].total {
+			problems = append(problems, fmt.Sprintf("total shrank at sample %d", i))
+		}
+	}
+	if n := len(r.samples); n > 2*rateResolution+2 {
+		problems = append(problems, fmt.Sprintf("%d samples kept, expected at most %d", n, 2*rateResolution+2))
+	}
+	return problems
+}
@@ -0,0 +1,78 @@
+package variant
+
+import (
+	"container/ring"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAuditHealthy(t *testing.T) {
+	unregisterAfter(t, "test.audit.healthy", "test.audit.rate")
+	s := NewSimpleMovingPercentile("test.audit.healthy", 0.5, 3)
+	s.Update(1)
+	s.Update(2)
+	s.Value()
+	c := NewInt("")
+	r := NewCounterRate("test.audit.rate", c, time.Minute)
+	r.Value()
+
+	for name, problems := range Audit() {
+		if name == "test.audit.healthy" || name == "test.audit.rate" {
+			t.Errorf("%s: unexpected findings %v", name, problems)
+		}
+	}
+}
+
+func TestAuditFindsStaleSnapshot(t *testing.T) {
+	unregisterAfter(t, "test.audit.broken")
+	s := NewSimpleMovingAverage("test.audit.broken", 3)
+	s.Update(1)
+	s.Values()
+	// corrupt the snapshot behind the window's back
+	(*s.snapshot.Load())[0] = 5.0
+
+	if problems := Audit()["test.audit.broken"]; len(problems) != 1 {
+		t.Errorf("expected one finding, got %v", problems)
+	}
+}
+
+func TestAuditFindsBadSize(t *testing.T) {
+	s := NewSimpleMovingAverage("", 3)
+	s.values = ring.New(2)
+	s.percentile.Store(math.Float64bits(2))
+	if problems := s.Audit(); len(problems) != 2 {
+		t.Errorf("expected ring size and percentile findings, got %v", problems)
+	}
+}
+
+func TestAuditFindsDriftedSum(t *testing.T) {
+	s := NewSimpleMovingAverage("", 3)
+	s.UpdateBatch([]float64{1, 2, math.NaN()})
+	if problems := s.Audit(); len(problems) != 0 {
+		t.Fatalf("expected no findings, got %v", problems)
+	}
+	s.sum.sum += 0.5
+	if problems := s.Audit(); len(problems) != 1 {
+		t.Errorf("expected a running sum finding, got %v", problems)
+	}
+	s.sum.sum -= 0.5
+	s.sum.nan = 0
+	if problems := s.Audit(); len(problems) != 1 {
+		t.Errorf("expected a NaN count finding, got %v", problems)
+	}
+}
+
+func TestAuditFindsMisorderedTree(t *testing.T) {
+	s := NewSimpleMovingMedian("", 3)
+	s.UpdateBatch([]float64{3, 1, 2})
+	s.Value()
+	if problems := s.Audit(); len(problems) != 0 {
+		t.Fatalf("expected no findings, got %v", problems)
+	}
+	// swap a value in the tree for one the window never held
+	s.tree.nodes[s.tree.root].value = 7
+	if problems := s.Audit(); len(problems) != 1 {
+		t.Errorf("expected an order tree finding, got %v", problems)
+	}
+}
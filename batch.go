@@ -0,0 +1,110 @@
+package variant
+
+import (
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Implemented by stats which can absorb a batch of values at once
+type BatchUpdater interface {
+	UpdateBatch(vals []float64)
+}
+
+// the number of values a stripe holds before the producer flushes it
+const batchStripeSize = 256
+
+// a single stripe of a Batcher, padded out to its own cache line
+type batchStripe struct {
+	mutex  sync.Mutex
+	values []float64
+	_      [64]byte
+}
+
+// Batcher accumulates updates in striped local buffers and merges
+// them into a shared stat on a short interval, so that goroutines
+// hammering the same stat mostly contend on different stripes instead
+// of the stat's own lock.
+//
+// Values from different stripes are merged in no particular order,
+// and reads of the underlying stat lag by up to one interval.
+type Batcher struct {
+	dst     BatchUpdater
+	stripes []batchStripe
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Create a new Batcher feeding `dst`, flushing every `interval`. There
+// is one stripe per GOMAXPROCS. Call Stop when done with it to flush
+// the remaining values and release the background goroutine.
+//
+// Like time.NewTicker, it panics if `interval` is not positive.
+func NewBatcher(dst BatchUpdater, interval time.Duration) *Batcher {
+	if interval <= 0 {
+		panic("variant: non-positive interval for NewBatcher")
+	}
+	b := new(Batcher)
+	b.dst = dst
+	b.stripes = make([]batchStripe, runtime.GOMAXPROCS(0))
+	for i := range b.stripes {
+		b.stripes[i].values = make([]float64, 0, batchStripeSize)
+	}
+	b.done = make(chan struct{})
+	b.stopped = make(chan struct{})
+
+	go b.run(interval)
+	return b
+}
+
+// Append a new value to a randomly chosen stripe
+func (b *Batcher) Update(val float64) {
+	st := &b.stripes[rand.Uint32()%uint32(len(b.stripes))]
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.values = append(st.values, val)
+	if len(st.values) >= batchStripeSize {
+		b.dst.UpdateBatch(st.values)
+		st.values = st.values[:0]
+	}
+}
+
+// Merge every stripe into the underlying stat now
+func (b *Batcher) Flush() {
+	for i := range b.stripes {
+		st := &b.stripes[i]
+		st.mutex.Lock()
+		if len(st.values) > 0 {
+			b.dst.UpdateBatch(st.values)
+			st.values = st.values[:0]
+		}
+		st.mutex.Unlock()
+	}
+}
+
+// Stop the periodic flush, merging whatever is still buffered.
+// Updates after Stop are buffered but only merged by an explicit Flush.
+func (b *Batcher) Stop() {
+	b.once.Do(func() {
+		close(b.done)
+		<-b.stopped
+	})
+}
+
+func (b *Batcher) run(interval time.Duration) {
+	defer close(b.stopped)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			b.Flush()
+		case <-b.done:
+			b.Flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package variant
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUpdateBatch(t *testing.T) {
+	s := NewSimpleMovingAverage("", 3)
+	s.UpdateBatch([]float64{1, 2, 3, 4})
+	if avg := s.Value(); avg != 3.0 {
+		t.Errorf("expected avg of 3.0, got %f", avg)
+	}
+}
+
+func TestBatcherFlush(t *testing.T) {
+	s := NewSimpleMovingAverage("", 10)
+	b := NewBatcher(s, time.Hour)
+	defer b.Stop()
+
+	b.Update(1)
+	b.Update(3)
+	if n := len(s.Values()); n != 0 {
+		t.Errorf("expected values to be buffered, got %d in window", n)
+	}
+	b.Flush()
+	if avg := s.Value(); avg != 2.0 {
+		t.Errorf("expected avg of 2.0, got %f", avg)
+	}
+}
+
+func TestBatcherStopFlushes(t *testing.T) {
+	s := NewSimpleMovingAverage("", 10000)
+	b := NewBatcher(s, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				b.Update(1)
+			}
+		}()
+	}
+	wg.Wait()
+	b.Stop()
+	b.Stop()
+
+	if n := len(s.Values()); n != 4000 {
+		t.Errorf("expected 4000 values, got %d", n)
+	}
+}
+
+func TestBatcherInterval(t *testing.T) {
+	s := NewSimpleMovingAverage("", 10)
+	b := NewBatcher(s, time.Millisecond)
+	defer b.Stop()
+
+	b.Update(7)
+	deadline := time.Now().Add(time.Second)
+	for len(s.Values()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if avg := s.Value(); avg != 7.0 {
+		t.Errorf("expected avg of 7.0, got %f", avg)
+	}
+}
+
+func BenchmarkUpdateBatcher(b *testing.B) {
+	s := NewSimpleMovingAverage("", 100)
+	bt := NewBatcher(s, 10*time.Millisecond)
+	defer bt.Stop()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			bt.Update(1)
+		}
+	})
+}
+
+func TestBatcherRejectsBadInterval(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected NewBatcher to panic on a zero interval")
+		}
+	}()
+	NewBatcher(NewSimpleMovingAverage("", 1), 0)
+}
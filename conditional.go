@@ -0,0 +1,110 @@
+package variant
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Wrap a handler serving JSON snapshots so that responses carry an
+// ETag, requests with a matching If-None-Match get an empty 304, and
+// clients accepting gzip get a compressed body. Scrapers of large
+// registries then pay for bandwidth only when something changed.
+//
+// The ETag is a hash of the rendered body, with a "-gzip" suffix on
+// compressed responses so each content-coding has its own tag. Vars
+// published outside this package change without notice, so there is
+// no revision counter that could vouch for an unchanged snapshot, and
+// the snapshot is rendered on every request: this saves bandwidth,
+// not CPU. Any var which changes on every render also defeats the
+// 304; memstats does, so Handler(VisibilityInternal) effectively
+// never matches unless narrowed with ?match=.
+func ConditionalHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+		h.ServeHTTP(buf, r)
+
+		for k, v := range buf.header {
+			w.Header()[k] = v
+		}
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+
+		gzipped := acceptsGzip(r.Header.Get("Accept-Encoding"))
+		sum := fnv.New64a()
+		sum.Write(buf.body.Bytes())
+		etag := fmt.Sprintf(`"%016x"`, sum.Sum64())
+		if gzipped {
+			etag = fmt.Sprintf(`"%016x-gzip"`, sum.Sum64())
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if !gzipped {
+			w.Header().Set("Content-Length", strconv.Itoa(buf.body.Len()))
+			w.Write(buf.body.Bytes())
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(buf.body.Bytes())
+		gz.Close()
+	})
+}
+
+// an http.ResponseWriter holding the response in memory
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+// whether an If-None-Match header lists `etag`
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		q := strings.TrimPrefix(strings.TrimSpace(params), "q=")
+		if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+			return false
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package variant
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var fixed = ConditionalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	io.WriteString(w, `{"a": 1}`)
+}))
+
+func TestConditionalETag(t *testing.T) {
+	rec := httptest.NewRecorder()
+	fixed.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Body.String() != `{"a": 1}` {
+		t.Fatalf("expected body with an etag, got %q %q", etag, rec.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	rec = httptest.NewRecorder()
+	fixed.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("expected empty 304, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestConditionalGzip(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+	rec := httptest.NewRecorder()
+	fixed.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip encoding")
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(gz)
+	if string(body) != `{"a": 1}` {
+		t.Errorf("expected decompressed body, got %q", body)
+	}
+}
+
+func TestConditionalGzipRefused(t *testing.T) {
+	if acceptsGzip("gzip;q=0") {
+		t.Errorf("expected q=0 to refuse gzip")
+	}
+	if acceptsGzip("") {
+		t.Errorf("expected no gzip without Accept-Encoding")
+	}
+}
+
+func TestConditionalPassesErrors(t *testing.T) {
+	h := ConditionalHandler(new(DumpHandler))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusForbidden || rec.Header().Get("ETag") != "" {
+		t.Errorf("expected untouched 403, got %d", rec.Code)
+	}
+}
+
+func TestConditionalETagPerEncoding(t *testing.T) {
+	plain := httptest.NewRecorder()
+	fixed.ServeHTTP(plain, httptest.NewRequest("GET", "/", nil))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	gz := httptest.NewRecorder()
+	fixed.ServeHTTP(gz, req)
+
+	if plain.Header().Get("ETag") == gz.Header().Get("ETag") {
+		t.Errorf("expected distinct etags per content-coding, got %s", plain.Header().Get("ETag"))
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", plain.Header().Get("ETag"))
+	rec := httptest.NewRecorder()
+	fixed.ServeHTTP(rec, req)
+	if rec.Code == http.StatusNotModified {
+		t.Errorf("expected the identity etag not to validate a gzip response")
+	}
+}
@@ -0,0 +1,42 @@
+package variant
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// represents a monotonically increasing count of events. It is lock
+// free and thread/goroutine safe.
+type Int struct {
+	val atomic.Int64
+}
+
+// Create a new counter expvar.Var. It will be published under `name`
+// and starts at zero.
+//
+// An empty name will cause it to not be published.
+func NewInt(name string) *Int {
+	c := new(Int)
+	publish(name, c)
+	return c
+}
+
+// display the value as a string
+func (c *Int) String() string {
+	return strconv.FormatInt(c.Value(), 10)
+}
+
+// add one to the count
+func (c *Int) Inc() {
+	c.val.Add(1)
+}
+
+// add `delta` to the count
+func (c *Int) Add(delta int64) {
+	c.val.Add(delta)
+}
+
+// obtain the current count
+func (c *Int) Value() int64 {
+	return c.val.Load()
+}
@@ -0,0 +1,41 @@
+package variant
+
+import (
+	"expvar"
+	"sync"
+	"testing"
+)
+
+func TestIntAsVar(t *testing.T) {
+	var _ expvar.Var = NewInt("")
+}
+
+func TestIntIncAndAdd(t *testing.T) {
+	c := NewInt("")
+	c.Inc()
+	c.Add(41)
+	if v := c.Value(); v != 42 {
+		t.Errorf("expected 42, got %d", v)
+	}
+	if st := c.String(); st != "42" {
+		t.Errorf("expected '42', got %s", st)
+	}
+}
+
+func TestIntConcurrentInc(t *testing.T) {
+	c := NewInt("")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	if v := c.Value(); v != 4000 {
+		t.Errorf("expected 4000, got %d", v)
+	}
+}
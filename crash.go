@@ -0,0 +1,82 @@
+package variant
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Write a snapshot of every published var to `w`, in the same JSON
+// shape as /debug/vars. Deltas are left out, since rendering them
+// would steal the increase from the next scrape.
+func WriteSnapshot(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	writeVars(buf, published{}, VisibilityInternal, selectPassive)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Write a final snapshot to `w` if the program is panicking, then
+// carry on panicking. It must be deferred directly, typically first
+// thing in main, so the last known metrics survive a crash for
+// postmortem analysis:
+//
+//	func main() {
+//		defer variant.DumpOnPanic(os.Stderr)
+//		...
+//	}
+//
+// Panics in other goroutines are not seen.
+func DumpOnPanic(w io.Writer) {
+	if r := recover(); r != nil {
+		WriteSnapshot(w)
+		panic(r)
+	}
+}
+
+// Write a final snapshot to `w` when the process receives one of
+// `sigs`, SIGTERM if none are given, then stop watching and call
+// `then` with the signal, if it is not nil.
+//
+// Watching a signal with signal.Notify replaces its default action,
+// so a process relying on the default to exit on SIGTERM must exit
+// in `then`:
+//
+//	variant.DumpOnSignal(f, func(os.Signal) { os.Exit(1) })
+//
+// A process with its own signal.Notify handler for graceful shutdown
+// receives the signal there as usual and can pass a nil `then`.
+//
+// It returns a function which stops watching for the signals.
+func DumpOnSignal(w io.Writer, then func(sig os.Signal), sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+
+	go func() {
+		select {
+		case sig := <-ch:
+			WriteSnapshot(w)
+			stop()
+			if then != nil {
+				then(sig)
+			}
+		case <-done:
+		}
+	}()
+	return stop
+}
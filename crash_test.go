@@ -0,0 +1,52 @@
+package variant
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWriteSnapshot(t *testing.T) {
+	unregisterAfter(t, "test.crash.snapshot")
+	NewGauge("test.crash.snapshot")
+	buf := new(bytes.Buffer)
+	if err := WriteSnapshot(buf); err != nil {
+		t.Fatal(err)
+	}
+	vars := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(buf.Bytes(), &vars); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if _, ok := vars["test.crash.snapshot"]; !ok {
+		t.Errorf("expected snapshot to include test.crash.snapshot")
+	}
+}
+
+func TestDumpOnPanic(t *testing.T) {
+	unregisterAfter(t, "test.crash.panic")
+	NewGauge("test.crash.panic")
+	buf := new(bytes.Buffer)
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("expected the panic to continue, got %v", r)
+			}
+		}()
+		defer DumpOnPanic(buf)
+		panic("boom")
+	}()
+	if !strings.Contains(buf.String(), "test.crash.panic") {
+		t.Errorf("expected a snapshot to be written")
+	}
+}
+
+func TestDumpOnPanicQuiet(t *testing.T) {
+	buf := new(bytes.Buffer)
+	func() {
+		defer DumpOnPanic(buf)
+	}()
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing written without a panic")
+	}
+}
@@ -0,0 +1,75 @@
+//go:build unix
+
+package variant
+
+import (
+	"bytes"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// a writer safe to poll while the signal goroutine writes to it
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Len()
+}
+
+func TestDumpOnSignal(t *testing.T) {
+	buf := new(lockedBuffer)
+	got := make(chan os.Signal, 1)
+	stop := DumpOnSignal(buf, func(sig os.Signal) { got <- sig }, syscall.SIGWINCH)
+	defer stop()
+
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(syscall.SIGWINCH)
+
+	select {
+	case sig := <-got:
+		if sig != syscall.SIGWINCH {
+			t.Errorf("expected SIGWINCH, got %v", sig)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected then to be called")
+	}
+	if buf.Len() == 0 {
+		t.Errorf("expected a snapshot to be written before then")
+	}
+}
+
+func TestDumpOnSignalKeepsOtherHandlers(t *testing.T) {
+	own := make(chan os.Signal, 2)
+	signal.Notify(own, syscall.SIGWINCH)
+	defer signal.Stop(own)
+
+	done := make(chan bool, 1)
+	stop := DumpOnSignal(new(lockedBuffer), func(os.Signal) { done <- true }, syscall.SIGWINCH)
+	defer stop()
+
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(syscall.SIGWINCH)
+	<-done
+	<-own
+
+	p.Signal(syscall.SIGWINCH)
+	select {
+	case <-own:
+	case <-time.After(time.Second):
+		t.Errorf("expected the application's handler to keep receiving signals")
+	}
+}
@@ -0,0 +1,63 @@
+package variant
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Implemented by monotonic counters, such as *Int and *expvar.Int
+type IntSource interface {
+	Value() int64
+}
+
+// represents the change in a monotonic counter since it was last read
+// it is thread/goroutine safe
+type Delta struct {
+	mutex  *sync.Mutex
+	source IntSource
+	last   int64
+}
+
+// Create a new delta expvar.Var. It will be published under `name`
+// and report how much `source` has grown between successive reads,
+// so each scrape of /debug/vars sees the per-scrape increase rather
+// than the running total.
+//
+// If the counter goes backwards it is assumed to have been reset, and
+// the delta is its value since the reset.
+//
+// Every render starts a new interval, so a delta must have a single
+// reader to mean anything. FlightRecorder and WriteSnapshot leave
+// deltas out of their snapshots for that reason; two scrapers of the
+// same endpoint will still split the increase between them.
+//
+// An empty name will cause it to not be published.
+func NewDelta(name string, source IntSource) *Delta {
+	d := new(Delta)
+	d.mutex = new(sync.Mutex)
+	d.source = source
+	d.last = source.Value()
+	publish(name, d)
+	return d
+}
+
+func (d *Delta) resetsOnRead() {}
+
+// display the value as a string. Like Value, this counts as a read.
+func (d *Delta) String() string {
+	return strconv.FormatInt(d.Value(), 10)
+}
+
+// obtain the change since the previous read, and start a new interval
+func (d *Delta) Value() int64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	cur := d.source.Value()
+	delta := cur - d.last
+	if cur < d.last {
+		delta = cur
+	}
+	d.last = cur
+	return delta
+}
@@ -0,0 +1,33 @@
+package variant
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestDeltaBetweenReads(t *testing.T) {
+	c := NewInt("")
+	c.Add(10)
+	d := NewDelta("", c)
+	if v := d.Value(); v != 0 {
+		t.Errorf("expected 0, got %d", v)
+	}
+	c.Add(5)
+	if v := d.Value(); v != 5 {
+		t.Errorf("expected 5, got %d", v)
+	}
+	c.Add(2)
+	if st := d.String(); st != "2" {
+		t.Errorf("expected '2', got %s", st)
+	}
+}
+
+func TestDeltaReset(t *testing.T) {
+	src := new(expvar.Int)
+	src.Set(100)
+	d := NewDelta("", src)
+	src.Set(3)
+	if v := d.Value(); v != 3 {
+		t.Errorf("expected 3 after reset, got %d", v)
+	}
+}
@@ -0,0 +1,70 @@
+package variant
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Implemented by stats backed by a window of raw samples
+type windowed interface {
+	Values() []float64
+}
+
+// Implemented by windows which know when each sample was recorded
+type timedWindow interface {
+	Samples() []TimedSample
+}
+
+// DumpHandler serves the raw samples behind a published stat, oldest
+// first and with their timestamps where the stat keeps them, for
+// checking where a suspicious value came from:
+//
+//	GET /debug/variant/dump?name=db.latency
+//
+// Raw samples can be sensitive and large, so the handler refuses every
+// request unless Authorize is set and approves it.
+type DumpHandler struct {
+	// decides whether a request may see raw samples
+	Authorize func(r *http.Request) bool
+}
+
+func (h *DumpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Authorize == nil || !h.Authorize(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	v := Get(name)
+	if v == nil {
+		http.Error(w, "no such stat", http.StatusNotFound)
+		return
+	}
+	win, ok := v.(windowed)
+	if !ok {
+		http.Error(w, "stat has no sample window", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\"name\": %s, \"samples\": [", strconv.Quote(name))
+	if timed, ok := v.(timedWindow); ok {
+		for i, s := range timed.Samples() {
+			if i > 0 {
+				fmt.Fprintf(w, ", ")
+			}
+			fmt.Fprintf(w, "{\"seq\": %d, \"time\": %q, \"value\": %s}",
+				i, s.Time.Format(time.RFC3339Nano), formatFloat(s.Value))
+		}
+	} else {
+		for i, val := range win.Values() {
+			if i > 0 {
+				fmt.Fprintf(w, ", ")
+			}
+			fmt.Fprintf(w, "{\"seq\": %d, \"value\": %s}", i, formatFloat(val))
+		}
+	}
+	fmt.Fprintf(w, "]}\n")
+}
@@ -0,0 +1,64 @@
+package variant
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func dump(h *DumpHandler, name string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/variant/dump?name="+name, nil))
+	return rec
+}
+
+func allowAll(r *http.Request) bool {
+	return true
+}
+
+func TestDumpDisabledByDefault(t *testing.T) {
+	unregisterAfter(t, "test.dump.disabled")
+	NewSimpleMovingAverage("test.dump.disabled", 3)
+	if rec := dump(new(DumpHandler), "test.dump.disabled"); rec.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestDumpSamples(t *testing.T) {
+	unregisterAfter(t, "test.dump.samples")
+	s := NewSimpleMovingAverage("test.dump.samples", 2)
+	s.Update(1)
+	s.Update(2)
+	s.Update(3)
+
+	rec := dump(&DumpHandler{Authorize: allowAll}, "test.dump.samples")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var body struct {
+		Name    string
+		Samples []struct {
+			Seq   int
+			Value float64
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", rec.Body.String(), err)
+	}
+	if len(body.Samples) != 2 || body.Samples[0].Value != 2 || body.Samples[1].Value != 3 {
+		t.Errorf("expected samples [2 3], got %+v", body.Samples)
+	}
+}
+
+func TestDumpUnknownAndUnwindowed(t *testing.T) {
+	unregisterAfter(t, "test.dump.gauge")
+	h := &DumpHandler{Authorize: allowAll}
+	if rec := dump(h, "test.dump.missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+	NewGauge("test.dump.gauge")
+	if rec := dump(h, "test.dump.gauge"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,180 @@
+package variant
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// represents one logical stat split by label values, e.g. a latency
+// percentile per method and path, each child a SimpleMovingStat
+// created on first use
+// it is thread/goroutine safe
+type StatFamily struct {
+	labelNames []string
+	create     func() *SimpleMovingStat
+	mutex      *sync.RWMutex
+	children   map[string]*familyChild
+}
+
+type familyChild struct {
+	labels []string
+	stat   *SimpleMovingStat
+}
+
+// Create a new moving percentile family expvar.Var. It will be
+// published under `name`, and each child created by WithLabels will
+// maintain `size` values for calculating the percentile. It renders as
+// a JSON object keyed by the label names and values of each child:
+//
+//	{"method=GET,path=/users": 12.000000, "method=POST,path=/users": 30.000000}
+//
+// percentile must be between 0 and 1
+//
+// An empty name will cause it to not be published.
+func NewMovingPercentileFamily(name string, percentile float64, size int, labelNames ...string) *StatFamily {
+	f := newStatFamily(labelNames, func() *SimpleMovingStat {
+		return NewSimpleMovingPercentile("", percentile, size)
+	})
+	publish(name, f)
+	return f
+}
+
+// Create a new moving average family expvar.Var. It will be published
+// under `name`, and each child created by WithLabels will maintain
+// `size` values for calculating the average.
+//
+// An empty name will cause it to not be published.
+func NewMovingAverageFamily(name string, size int, labelNames ...string) *StatFamily {
+	f := newStatFamily(labelNames, func() *SimpleMovingStat {
+		return NewSimpleMovingAverage("", size)
+	})
+	publish(name, f)
+	return f
+}
+
+func newStatFamily(labelNames []string, create func() *SimpleMovingStat) *StatFamily {
+	f := new(StatFamily)
+	f.labelNames = append([]string(nil), labelNames...)
+	f.create = create
+	f.mutex = new(sync.RWMutex)
+	f.children = make(map[string]*familyChild)
+	return f
+}
+
+// display every child as a JSON object
+func (f *StatFamily) String() string {
+	var b strings.Builder
+	b.WriteString("{")
+	f.Each(func(labels []string, s *SimpleMovingStat) {
+		if b.Len() > 1 {
+			b.WriteString(", ")
+		}
+		b.WriteString(strconv.Quote(f.label(labels)))
+		b.WriteString(": ")
+		b.WriteString(s.String())
+	})
+	b.WriteString("}")
+	return b.String()
+}
+
+// Obtain the child stat for `values`, one per label name in order,
+// creating it if this is the first time they are seen. It panics when
+// the number of values does not match the number of label names.
+//
+// Every distinct set of values keeps its own window until removed, so
+// values should come from a small, fixed set such as methods or
+// routes, never from user input.
+func (f *StatFamily) WithLabels(values ...string) *SimpleMovingStat {
+	if len(values) != len(f.labelNames) {
+		panic(fmt.Sprintf("variant: %d label values for %d label names", len(values), len(f.labelNames)))
+	}
+	key := childKey(values)
+
+	f.mutex.RLock()
+	child, ok := f.children[key]
+	f.mutex.RUnlock()
+	if ok {
+		return child.stat
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if child, ok := f.children[key]; ok {
+		return child.stat
+	}
+	child = &familyChild{append([]string(nil), values...), f.create()}
+	f.children[key] = child
+	return child.stat
+}
+
+// Discard the child stat for `values`, if there is one
+func (f *StatFamily) Remove(values ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.children, childKey(values))
+}
+
+// Discard every child stat
+func (f *StatFamily) Reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.children = make(map[string]*familyChild)
+}
+
+// obtain the label names, in order
+func (f *StatFamily) LabelNames() []string {
+	return append([]string(nil), f.labelNames...)
+}
+
+// Call `fn` with the label values and stat of every child, ordered by
+// label values
+func (f *StatFamily) Each(fn func(labels []string, s *SimpleMovingStat)) {
+	f.mutex.RLock()
+	children := make([]*familyChild, 0, len(f.children))
+	for _, child := range f.children {
+		children = append(children, child)
+	}
+	f.mutex.RUnlock()
+
+	sort.Slice(children, func(i, j int) bool {
+		a, b := children[i].labels, children[j].labels
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	for _, child := range children {
+		fn(append([]string(nil), child.labels...), child.stat)
+	}
+}
+
+// the key a child is stored under: each value prefixed with its
+// length, so no two sets of values share one whatever they contain
+func childKey(values []string) string {
+	var b strings.Builder
+	for _, value := range values {
+		b.WriteString(strconv.Itoa(len(value)))
+		b.WriteString(":")
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+// escapes the characters which separate labels when rendering them
+var labelEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`)
+
+// the key a child is rendered under, e.g. "method=GET,path=/users".
+// Commas, equals signs and backslashes in values are escaped with a
+// backslash so that distinct children never render the same.
+func (f *StatFamily) label(values []string) string {
+	pairs := make([]string, len(values))
+	for i, value := range values {
+		pairs[i] = f.labelNames[i] + "=" + labelEscaper.Replace(value)
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,73 @@
+package variant
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+func TestFamilyAsVar(t *testing.T) {
+	var _ expvar.Var = NewMovingPercentileFamily("", 0.5, 3, "method")
+}
+
+func TestFamilyChildren(t *testing.T) {
+	f := NewMovingPercentileFamily("", 0.5, 10, "method", "path")
+	f.WithLabels("GET", "/users").UpdateBatch([]float64{1, 2, 3})
+	f.WithLabels("POST", "/users").Update(30)
+	f.WithLabels("GET", "/users").Update(4)
+
+	var body map[string]float64
+	if err := json.Unmarshal([]byte(f.String()), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", f.String(), err)
+	}
+	if len(body) != 2 || body["method=GET,path=/users"] != 3 || body["method=POST,path=/users"] != 30 {
+		t.Errorf("unexpected children %v", body)
+	}
+
+	f.Remove("POST", "/users")
+	var seen [][]string
+	f.Each(func(labels []string, s *SimpleMovingStat) {
+		seen = append(seen, labels)
+	})
+	if len(seen) != 1 || seen[0][0] != "GET" || seen[0][1] != "/users" {
+		t.Errorf("expected only GET /users to remain, got %v", seen)
+	}
+
+	f.Reset()
+	if s := f.String(); s != "{}" {
+		t.Errorf("expected no children after Reset, got %s", s)
+	}
+}
+
+func TestFamilySameChild(t *testing.T) {
+	f := NewMovingAverageFamily("", 3, "route")
+	if f.WithLabels("a") != f.WithLabels("a") {
+		t.Errorf("expected the same child for the same labels")
+	}
+}
+
+func TestFamilyValuesNeverCollide(t *testing.T) {
+	f := NewMovingAverageFamily("", 3, "a", "b")
+	f.WithLabels("p,b=q", "").Update(1)
+	f.WithLabels("p", "q,b=").Update(2)
+	if f.WithLabels("p,b=q", "") == f.WithLabels("p", "q,b=") {
+		t.Fatalf("expected distinct children for distinct values")
+	}
+
+	var body map[string]float64
+	if err := json.Unmarshal([]byte(f.String()), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", f.String(), err)
+	}
+	if len(body) != 2 || body[`a=p\,b\=q,b=`] != 1 || body[`a=p,b=q\,b\=`] != 2 {
+		t.Errorf("expected two escaped children, got %v", body)
+	}
+}
+
+func TestFamilyRejectsWrongLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for too few label values")
+		}
+	}()
+	NewMovingAverageFamily("", 3, "method", "path").WithLabels("GET")
+}
@@ -0,0 +1,73 @@
+package variant
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// represents a single current value, such as a queue depth or a
+// temperature. It is lock free and thread/goroutine safe.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Create a new gauge expvar.Var. It will be published under `name`
+// and starts at zero.
+//
+// An empty name will cause it to not be published.
+func NewGauge(name string) *Gauge {
+	g := new(Gauge)
+	publish(name, g)
+	return g
+}
+
+// display the value as a string
+func (g *Gauge) String() string {
+	return formatFloat(g.Value())
+}
+
+// replace the current value
+func (g *Gauge) Set(val float64) {
+	g.bits.Store(math.Float64bits(val))
+}
+
+// add `delta` (which may be negative) to the current value
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if g.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// obtain the current value
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// represents a value computed whenever it is read, such as the size
+// of a cache owned by some other package. It is as thread/goroutine
+// safe as the function is.
+type FloatFunc func() float64
+
+// Create a new float func expvar.Var. It will be published under
+// `name` and report what `fn` returns each time it is rendered.
+//
+// An empty name will cause it to not be published.
+func NewFloatFunc(name string, fn func() float64) FloatFunc {
+	f := FloatFunc(fn)
+	publish(name, f)
+	return f
+}
+
+// display the value as a string
+func (f FloatFunc) String() string {
+	return formatFloat(f())
+}
+
+// obtain the current value
+func (f FloatFunc) Value() float64 {
+	return f()
+}
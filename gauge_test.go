@@ -0,0 +1,66 @@
+package variant
+
+import (
+	"expvar"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestGaugeAsVar(t *testing.T) {
+	var _ expvar.Var = NewGauge("")
+}
+
+func TestGaugeSet(t *testing.T) {
+	g := NewGauge("")
+	if v := g.Value(); v != 0.0 {
+		t.Errorf("expected 0.0, got %f", v)
+	}
+	g.Set(2.5)
+	if v := g.Value(); v != 2.5 {
+		t.Errorf("expected 2.5, got %f", v)
+	}
+}
+
+func TestGaugeConcurrentAdd(t *testing.T) {
+	g := NewGauge("")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				g.Add(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := g.Value(); v != 2000.0 {
+		t.Errorf("expected 2000.0, got %f", v)
+	}
+}
+
+func TestGaugeString(t *testing.T) {
+	g := NewGauge("")
+	g.Set(1.5)
+	if st := g.String(); st != "1.500000" {
+		t.Errorf("expected '1.500000', got %s", st)
+	}
+	g.Set(math.Inf(-1))
+	if st := g.String(); st != `"-Infinity"` {
+		t.Errorf("expected '\"-Infinity\"', got %s", st)
+	}
+}
+
+func TestFloatFunc(t *testing.T) {
+	unregisterAfter(t, "test.floatfunc")
+	val := 1.5
+	f := NewFloatFunc("test.floatfunc", func() float64 { return val })
+	if s := expvar.Get("test.floatfunc").String(); s != "1.500000" {
+		t.Errorf("expected 1.500000, got %s", s)
+	}
+	val = math.Inf(1)
+	if s := f.String(); s != `"+Infinity"` {
+		t.Errorf("expected a quoted infinity, got %s", s)
+	}
+}
@@ -0,0 +1,99 @@
+package variant
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// draws one synthetic value
+type Distribution func(r *rand.Rand) float64
+
+// values normally distributed around `mean`
+func Normal(mean, stddev float64) Distribution {
+	return func(r *rand.Rand) float64 {
+		return mean + stddev*r.NormFloat64()
+	}
+}
+
+// values whose logarithm is normally distributed, the usual shape of
+// request latencies: mostly fast with a long tail
+func LogNormal(mu, sigma float64) Distribution {
+	return func(r *rand.Rand) float64 {
+		return math.Exp(mu + sigma*r.NormFloat64())
+	}
+}
+
+// values drawn from `a` with probability `pa` and from `b` otherwise,
+// e.g. cache hits and misses
+func Bimodal(a, b Distribution, pa float64) Distribution {
+	return func(r *rand.Rand) float64 {
+		if r.Float64() < pa {
+			return a(r)
+		}
+		return b(r)
+	}
+}
+
+// values from `d`, multiplied by `factor` with probability `p`, for
+// checking that alerts fire on outliers
+func Spiky(d Distribution, p, factor float64) Distribution {
+	return func(r *rand.Rand) float64 {
+		v := d(r)
+		if r.Float64() < p {
+			v *= factor
+		}
+		return v
+	}
+}
+
+// Generator feeds synthetic values into a stat on a schedule, for
+// demoing dashboards and validating alert thresholds before real
+// traffic exists.
+type Generator struct {
+	// where the values go
+	Target Updater
+	// what they look like
+	Distribution Distribution
+	// how many values to feed per interval
+	Rate int
+	// how often to feed them; one second if zero
+	Interval time.Duration
+	// seeds the random source, so runs can be reproduced
+	Seed uint64
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+// feed one interval's worth of values right now
+func (g *Generator) Tick() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.rand == nil {
+		g.rand = rand.New(rand.NewPCG(g.Seed, g.Seed))
+	}
+	for i := 0; i < g.Rate; i++ {
+		g.Target.Update(g.Distribution(g.rand))
+	}
+}
+
+// feed values every interval until `ctx` is done, returning its error
+func (g *Generator) Run(ctx context.Context) error {
+	interval := g.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			g.Tick()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package variant
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGeneratorNormal(t *testing.T) {
+	sma := NewSimpleMovingAverage("", 10000)
+	g := &Generator{Target: sma, Distribution: Normal(100, 10), Rate: 10000, Seed: 1}
+	g.Tick()
+	if avg := sma.Value(); math.Abs(avg-100) > 1 {
+		t.Errorf("expected avg near 100, got %f", avg)
+	}
+}
+
+func TestGeneratorReproducible(t *testing.T) {
+	a := NewSimpleMovingAverage("", 100)
+	b := NewSimpleMovingAverage("", 100)
+	d := Spiky(LogNormal(0, 1), 0.1, 50)
+	(&Generator{Target: a, Distribution: d, Rate: 100, Seed: 7}).Tick()
+	(&Generator{Target: b, Distribution: d, Rate: 100, Seed: 7}).Tick()
+	if a.Value() != b.Value() {
+		t.Errorf("expected equal seeds to produce equal values")
+	}
+}
+
+func TestBimodal(t *testing.T) {
+	pct := NewSimpleMovingPercentile("", 0.5, 1000)
+	d := Bimodal(Normal(1, 0), Normal(100, 0), 0.9)
+	(&Generator{Target: pct, Distribution: d, Rate: 1000, Seed: 3}).Tick()
+	if v := pct.Value(); v != 1 {
+		t.Errorf("expected a median of 1, got %f", v)
+	}
+	pct.SetPercentile(0.99)
+	if v := pct.Value(); v != 100 {
+		t.Errorf("expected a p99 of 100, got %f", v)
+	}
+}
+
+func TestGeneratorRun(t *testing.T) {
+	sma := NewSimpleMovingAverage("", 10)
+	g := &Generator{Target: sma, Distribution: Normal(5, 0), Rate: 1, Interval: time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- g.Run(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for len(sma.Values()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if avg := sma.Value(); avg != 5.0 {
+		t.Errorf("expected avg of 5.0, got %f", avg)
+	}
+}
@@ -0,0 +1,268 @@
+package variant
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Create a handler serving the published vars in the same JSON shape
+// as /debug/vars, restricted to those at least as visible as `level`.
+//
+// Handler(VisibilityPublic) serves only stats described as public,
+// with string vars passed through their Redact hooks, and is suitable
+// for exposing outside the trust boundary. Handler(VisibilityInternal)
+// serves everything, like expvar.Handler.
+//
+// Query parameters narrow the response for registries with thousands
+// of vars:
+//
+//	match=db.*         only vars whose name matches the glob
+//	fields=p99,count   only these keys of vars whose value is an object
+//	offset=100         skip this many vars, in name order
+//	limit=50           serve at most this many vars
+//	metadata=1         serve each var's Help, Type and Unit instead
+//	                   of its value
+//
+// while q picks out a single value with a JSON Pointer (RFC 6901)
+// whose first segment is the var name, and serves just that value:
+//
+//	q=/memstats/PauseNs/0
+//	q=/db.latency/p99
+//
+// Responses support gzip and conditional requests, see
+// ConditionalHandler.
+func Handler(level Visibility) http.Handler {
+	return varsHandler(published{}, level)
+}
+
+// a handler serving `vars` as Handler describes
+func varsHandler(vars varSet, level Visibility) http.Handler {
+	return ConditionalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if q := query.Get("q"); q != "" {
+			serveQuery(w, vars, level, q)
+			return
+		}
+		sel, err := parseSelection(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		writeVars(w, vars, level, sel)
+	}))
+}
+
+// which vars, and which parts of them, a request asked for
+type selection struct {
+	match    string
+	fields   []string
+	metadata bool
+	// leave out vars which change state when rendered, for
+	// background snapshots which are not scrapes
+	passive bool
+	offset  int
+	limit   int
+}
+
+// everything
+var selectAll = selection{limit: -1}
+
+// everything that can be rendered without side effects
+var selectPassive = selection{limit: -1, passive: true}
+
+// Implemented by vars whose value is consumed by reading it, which
+// background snapshots must not render
+type readResetter interface {
+	resetsOnRead()
+}
+
+func parseSelection(query url.Values) (selection, error) {
+	sel := selectAll
+	if sel.match = query.Get("match"); sel.match != "" {
+		if _, err := path.Match(sel.match, ""); err != nil {
+			return sel, fmt.Errorf("bad match pattern %q", sel.match)
+		}
+	}
+	if fields := query.Get("fields"); fields != "" {
+		sel.fields = strings.Split(fields, ",")
+	}
+	sel.metadata = query.Get("metadata") != ""
+	if offset := query.Get("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return sel, fmt.Errorf("offset must be a non-negative integer")
+		}
+		sel.offset = n
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return sel, fmt.Errorf("limit must be a non-negative integer")
+		}
+		sel.limit = n
+	}
+	return sel, nil
+}
+
+// write the selected `vars` visible at `level` as a JSON object
+func writeVars(w io.Writer, vars varSet, level Visibility, sel selection) {
+	fmt.Fprintf(w, "{\n")
+	skipped, written := 0, 0
+	vars.Do(func(kv expvar.KeyValue) {
+		if sel.limit >= 0 && written >= sel.limit {
+			return
+		}
+		if sel.match != "" {
+			if ok, _ := path.Match(sel.match, kv.Key); !ok {
+				return
+			}
+		}
+		if _, ok := kv.Value.(readResetter); ok && sel.passive {
+			return
+		}
+		if !visible(kv.Key, level) {
+			return
+		}
+		// skipped vars are never rendered, which would cost time and
+		// consume any which reset on read
+		if skipped < sel.offset {
+			skipped++
+			return
+		}
+		var value string
+		if sel.metadata {
+			value = renderMetadata(MetadataFor(kv.Key))
+		} else {
+			value = renderValue(kv, level)
+		}
+		if written > 0 {
+			fmt.Fprintf(w, ",\n")
+		}
+		written++
+		fmt.Fprintf(w, "%q: %s", kv.Key, selectFields(value, sel.fields))
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
+
+// render a var for a handler serving `level`, reporting false when it
+// should not be served at all
+func render(kv expvar.KeyValue, level Visibility) (string, bool) {
+	if !visible(kv.Key, level) {
+		return "", false
+	}
+	return renderValue(kv, level), true
+}
+
+// whether the var published under `name` may be served at `level`
+func visible(name string, level Visibility) bool {
+	return MetadataFor(name).Visibility >= level
+}
+
+// render a var which is visible at `level`
+func renderValue(kv expvar.KeyValue, level Visibility) string {
+	if level > VisibilityInternal {
+		if s, ok := kv.Value.(*expvar.String); ok {
+			if redact := redactorFor(kv.Key); redact != nil {
+				return strconv.Quote(redact(s.Value()))
+			}
+		}
+	}
+	return kv.Value.String()
+}
+
+// render a var's description as a JSON object
+func renderMetadata(md Metadata) string {
+	return fmt.Sprintf("{\"help\": %s, \"type\": %s, \"unit\": %s}",
+		strconv.Quote(md.Help), strconv.Quote(string(md.Type)), strconv.Quote(md.Unit))
+}
+
+// cut a JSON object down to `fields`, in the order given. Values which
+// are not objects are returned unchanged.
+func selectFields(value string, fields []string) string {
+	if len(fields) == 0 || !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		return value
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &obj); err != nil {
+		return value
+	}
+	var b strings.Builder
+	b.WriteString("{")
+	for _, field := range fields {
+		raw, ok := obj[field]
+		if !ok {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%q: %s", field, raw)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// serve the single value `pointer` refers to
+func serveQuery(w http.ResponseWriter, vars varSet, level Visibility, pointer string) {
+	if !strings.HasPrefix(pointer, "/") {
+		http.Error(w, "q must be a JSON pointer starting with /", http.StatusBadRequest)
+		return
+	}
+	var tokens []string
+	for _, token := range strings.Split(pointer[1:], "/") {
+		tokens = append(tokens, strings.NewReplacer("~1", "/", "~0", "~").Replace(token))
+	}
+
+	v := vars.Get(tokens[0])
+	if v == nil {
+		http.Error(w, "no such var", http.StatusNotFound)
+		return
+	}
+	value, ok := render(expvar.KeyValue{Key: tokens[0], Value: v}, level)
+	if !ok {
+		http.Error(w, "no such var", http.StatusNotFound)
+		return
+	}
+
+	dec := json.NewDecoder(strings.NewReader(value))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		http.Error(w, "var is not valid JSON", http.StatusInternalServerError)
+		return
+	}
+	for _, token := range tokens[1:] {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			doc, ok = node[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			ok = err == nil && i >= 0 && i < len(node)
+			if ok {
+				doc = node[i]
+			}
+		default:
+			ok = false
+		}
+		if !ok {
+			http.Error(w, "no such value", http.StatusNotFound)
+			return
+		}
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "%s\n", out)
+}
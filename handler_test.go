@@ -0,0 +1,191 @@
+package variant
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveVars(level Visibility) map[string]json.RawMessage {
+	rec := httptest.NewRecorder()
+	Handler(level).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+	vars := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		panic(err)
+	}
+	return vars
+}
+
+func TestHandlerInternalServesAll(t *testing.T) {
+	unregisterAfter(t, "test.handler.internal")
+	NewGauge("test.handler.internal")
+	vars := serveVars(VisibilityInternal)
+	if _, ok := vars["test.handler.internal"]; !ok {
+		t.Errorf("expected internal stat to be served")
+	}
+	if _, ok := vars["memstats"]; !ok {
+		t.Errorf("expected memstats to be served")
+	}
+}
+
+func TestHandlerPublicFilters(t *testing.T) {
+	unregisterAfter(t, "test.handler.hidden", "test.handler.shown")
+	NewGauge("test.handler.hidden")
+	g := NewGauge("test.handler.shown")
+	g.Set(3)
+	Describe("test.handler.shown", Metadata{Visibility: VisibilityPublic})
+
+	vars := serveVars(VisibilityPublic)
+	if _, ok := vars["test.handler.hidden"]; ok {
+		t.Errorf("expected internal stat to be hidden")
+	}
+	if _, ok := vars["memstats"]; ok {
+		t.Errorf("expected memstats to be hidden")
+	}
+	if v := string(vars["test.handler.shown"]); v != "3.000000" {
+		t.Errorf("expected 3.000000, got %s", v)
+	}
+}
+
+func TestHandlerRedactsPublicStrings(t *testing.T) {
+	unregisterAfter(t, "test.handler.dsn")
+	s := new(expvar.String)
+	DefaultRegistry.Register("test.handler.dsn", s)
+	s.Set("sqlserver://sa:secret@db")
+	Describe("test.handler.dsn", Metadata{Visibility: VisibilityPublic})
+	Redact("test.handler.dsn", func(v string) string {
+		return strings.Replace(v, "secret", "xxx", -1)
+	})
+
+	if v := string(serveVars(VisibilityPublic)["test.handler.dsn"]); v != `"sqlserver://sa:xxx@db"` {
+		t.Errorf("expected redacted value, got %s", v)
+	}
+	if v := string(serveVars(VisibilityInternal)["test.handler.dsn"]); v != `"sqlserver://sa:secret@db"` {
+		t.Errorf("expected raw value internally, got %s", v)
+	}
+}
+
+func serveSelection(query string) (int, map[string]json.RawMessage) {
+	rec := httptest.NewRecorder()
+	Handler(VisibilityInternal).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars?"+query, nil))
+	vars := make(map[string]json.RawMessage)
+	if rec.Code == 200 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+			panic(err)
+		}
+	}
+	return rec.Code, vars
+}
+
+func TestHandlerMatch(t *testing.T) {
+	unregisterAfter(t, "test.select.a", "test.select.b", "test.other.c")
+	NewGauge("test.select.a")
+	NewGauge("test.select.b")
+	NewGauge("test.other.c")
+	_, vars := serveSelection("match=test.select.*")
+	if len(vars) != 2 {
+		t.Errorf("expected 2 vars, got %v", vars)
+	}
+	if code, _ := serveSelection("match=["); code != 400 {
+		t.Errorf("expected 400 for bad pattern, got %d", code)
+	}
+}
+
+func TestHandlerPagination(t *testing.T) {
+	names := []string{"test.page.1", "test.page.2", "test.page.3"}
+	unregisterAfter(t, names...)
+	for _, name := range names {
+		NewGauge(name)
+	}
+	_, vars := serveSelection("match=test.page.*&offset=1&limit=1")
+	if _, ok := vars["test.page.2"]; len(vars) != 1 || !ok {
+		t.Errorf("expected only test.page.2, got %v", vars)
+	}
+	if code, _ := serveSelection("limit=-1"); code != 400 {
+		t.Errorf("expected 400 for bad limit, got %d", code)
+	}
+}
+
+func TestHandlerOffsetLeavesSkippedDeltas(t *testing.T) {
+	unregisterAfter(t, "zz.offset.delta")
+	c := NewInt("")
+	d := NewDelta("zz.offset.delta", c)
+	c.Add(7)
+	serveSelection("match=zz.*&offset=1")
+	if v := d.Value(); v != 7 {
+		t.Errorf("expected the skipped delta to keep its 7, got %d", v)
+	}
+}
+
+func TestHandlerMetadataLeavesDeltas(t *testing.T) {
+	unregisterAfter(t, "zz.metadata.delta")
+	c := NewInt("")
+	d := NewDelta("zz.metadata.delta", c)
+	c.Add(5)
+	serveSelection("match=zz.metadata.*&metadata=1")
+	if v := d.Value(); v != 5 {
+		t.Errorf("expected listing metadata to leave the delta's 5, got %d", v)
+	}
+}
+
+func TestHandlerFields(t *testing.T) {
+	unregisterAfter(t, "test.fields.obj", "test.fields.scalar")
+	DefaultRegistry.Register("test.fields.obj", expvar.Func(func() interface{} {
+		return map[string]int{"count": 3, "p50": 1, "p99": 9}
+	}))
+	NewGauge("test.fields.scalar")
+	_, vars := serveSelection("match=test.fields.*&fields=p99,count")
+	if v := string(vars["test.fields.obj"]); v != `{"p99": 9, "count": 3}` {
+		t.Errorf("expected selected fields, got %s", v)
+	}
+	if v := string(vars["test.fields.scalar"]); v != "0.000000" {
+		t.Errorf("expected scalar untouched, got %s", v)
+	}
+}
+
+func query(q string) (int, string) {
+	rec := httptest.NewRecorder()
+	Handler(VisibilityInternal).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars?q="+q, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHandlerQuery(t *testing.T) {
+	unregisterAfter(t, "test.query.obj", "test.query.scalar")
+	DefaultRegistry.Register("test.query.obj", expvar.Func(func() interface{} {
+		return map[string]interface{}{"p99": 9.5, "list": []int{4, 5}, "a/b": "slash"}
+	}))
+	g := NewGauge("test.query.scalar")
+	g.Set(2)
+
+	for q, want := range map[string]string{
+		"/test.query.obj/p99":    "9.5\n",
+		"/test.query.obj/list/1": "5\n",
+		"/test.query.obj/a~1b":   "\"slash\"\n",
+		"/test.query.scalar":     "2.000000\n",
+	} {
+		if code, body := query(q); code != 200 || body != want {
+			t.Errorf("%s: expected %q, got %d %q", q, want, code, body)
+		}
+	}
+	for _, q := range []string{"/test.query.obj/missing", "/test.query.obj/list/7", "/test.query.none"} {
+		if code, _ := query(q); code != 404 {
+			t.Errorf("%s: expected 404, got %d", q, code)
+		}
+	}
+	if code, _ := query("test.query.obj"); code != 400 {
+		t.Errorf("expected 400 for a relative pointer, got %d", code)
+	}
+}
+
+func TestHandlerMetadata(t *testing.T) {
+	unregisterAfter(t, "test.describe.requests")
+	NewInt("test.describe.requests")
+	Describe("test.describe.requests", Metadata{Help: "requests served", Unit: "requests"})
+	_, vars := serveSelection("match=test.describe.*&metadata=1")
+	want := `{"help": "requests served", "type": "counter", "unit": "requests"}`
+	if v := string(vars["test.describe.requests"]); v != want {
+		t.Errorf("expected %s, got %s", want, v)
+	}
+}
@@ -0,0 +1,318 @@
+package variant
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// represents the distribution of every value seen as counts in
+// buckets, so memory stays fixed however long the service runs and
+// counts from several instances can be added together. Percentiles
+// are estimated by interpolating within the bucket they fall in.
+// it is thread/goroutine safe
+type Histogram struct {
+	mutex       *sync.Mutex
+	bounds      []float64
+	counts      []int64
+	gamma       float64
+	logCounts   map[int]int64
+	count       int64
+	sum         float64
+	min         float64
+	max         float64
+	percentiles []float64
+}
+
+// a bucket of a Histogram: how many values were above the previous
+// bucket's UpperBound and at most this one's
+type HistogramBucket struct {
+	UpperBound float64
+	Count      int64
+}
+
+// Create a new histogram expvar.Var with fixed buckets. It will be
+// published under `name` and count values into one bucket per upper
+// bound in `bounds`, which must be ascending, plus one for values
+// above them all. It renders as a JSON object such as
+//
+//	{"count":3,"sum":7.000000,"min":1.000000,"max":4.000000,
+//	 "buckets":[{"le":1.000000,"count":1},{"le":"+Infinity","count":2}],
+//	 "p50":1.750000}
+//
+// with one "p" key per percentile. With no percentiles it reports
+// p50, p95 and p99.
+//
+// percentiles must be between 0 and 1
+//
+// An empty name will cause it to not be published.
+func NewHistogram(name string, bounds []float64, percentiles ...float64) *Histogram {
+	for i := 1; i < len(bounds); i++ {
+		if !(bounds[i-1] < bounds[i]) {
+			panic("variant: histogram bounds must be ascending")
+		}
+	}
+	h := newHistogram(percentiles)
+	h.bounds = append([]float64(nil), bounds...)
+	h.counts = make([]int64, len(bounds)+1)
+	publish(name, h)
+	return h
+}
+
+// Create a new histogram expvar.Var with logarithmic buckets created
+// as values arrive, in the manner of HDR histograms. It will be
+// published under `name`, and each positive value lands in a bucket
+// no wider than `relativeError` times its value, e.g. 0.01 for 1%, so
+// a range of 1ns to an hour needs under 1500 buckets. Values of zero
+// or less share one bucket. It renders as NewHistogram describes,
+// listing only buckets which hold values.
+//
+// relativeError must be between 0 and 1, exclusive, and percentiles
+// between 0 and 1
+//
+// An empty name will cause it to not be published.
+func NewLogHistogram(name string, relativeError float64, percentiles ...float64) *Histogram {
+	if !(relativeError > 0 && relativeError < 1) {
+		panic("variant: relative error for NewLogHistogram must be between 0 and 1")
+	}
+	h := newHistogram(percentiles)
+	h.gamma = (1 + relativeError) / (1 - relativeError)
+	h.logCounts = make(map[int]int64)
+	publish(name, h)
+	return h
+}
+
+func newHistogram(percentiles []float64) *Histogram {
+	if len(percentiles) == 0 {
+		percentiles = defaultSummaryPercentiles
+	}
+	h := new(Histogram)
+	h.mutex = new(sync.Mutex)
+	h.percentiles = checkPercentiles(percentiles)
+	h.min = math.NaN()
+	h.max = math.NaN()
+	return h
+}
+
+// Create `count` bucket bounds, the first `start` and each `width`
+// more than the one before
+func LinearBuckets(start, width float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start + float64(i)*width
+	}
+	return bounds
+}
+
+// Create `count` bucket bounds, the first `start` and each `factor`
+// times the one before
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start * math.Pow(factor, float64(i))
+	}
+	return bounds
+}
+
+// display the histogram as a JSON object
+func (h *Histogram) String() string {
+	h.mutex.Lock()
+	buckets := h.buckets()
+	count, sum, min, max := h.count, h.sum, h.min, h.max
+	gamma, percentiles := h.gamma, h.percentiles
+	h.mutex.Unlock()
+
+	var b strings.Builder
+	b.WriteString(`{"count":`)
+	b.WriteString(strconv.FormatInt(count, 10))
+	b.WriteString(`,"sum":`)
+	b.WriteString(formatFloat(sum))
+	b.WriteString(`,"min":`)
+	b.WriteString(formatFloat(min))
+	b.WriteString(`,"max":`)
+	b.WriteString(formatFloat(max))
+	b.WriteString(`,"buckets":[`)
+	for i, bucket := range buckets {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(`{"le":`)
+		b.WriteString(formatFloat(bucket.UpperBound))
+		b.WriteString(`,"count":`)
+		b.WriteString(strconv.FormatInt(bucket.Count, 10))
+		b.WriteString("}")
+	}
+	b.WriteString("]")
+	for _, p := range percentiles {
+		b.WriteString(`,"`)
+		b.WriteString(percentileKey(p))
+		b.WriteString(`":`)
+		b.WriteString(formatFloat(estimatePercentile(buckets, gamma, count, min, max, p)))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// Count a new value
+func (h *Histogram) Update(val float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.observe(val)
+}
+
+// Count several values, taking the lock once
+func (h *Histogram) UpdateBatch(vals []float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, val := range vals {
+		h.observe(val)
+	}
+}
+
+// count a value. NaN is counted but lands in no bucket. Must be
+// called with the mutex held.
+func (h *Histogram) observe(val float64) {
+	h.count++
+	if math.IsNaN(val) {
+		return
+	}
+	h.sum += val
+	if math.IsNaN(h.min) || val < h.min {
+		h.min = val
+	}
+	if math.IsNaN(h.max) || val > h.max {
+		h.max = val
+	}
+
+	if h.logCounts != nil {
+		h.logCounts[h.logIndex(val)]++
+		return
+	}
+	h.counts[sort.SearchFloat64s(h.bounds, val)]++
+}
+
+// the log bucket `val` lands in: the smallest k with val <= gamma^k,
+// math.MinInt for values of zero or less, or math.MaxInt for +Inf
+func (h *Histogram) logIndex(val float64) int {
+	if val <= 0 {
+		return math.MinInt
+	}
+	if math.IsInf(val, 1) {
+		return math.MaxInt
+	}
+	return int(math.Ceil(math.Log(val) / math.Log(h.gamma)))
+}
+
+// Discard every count
+func (h *Histogram) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.logCounts != nil {
+		h.logCounts = make(map[int]int64)
+	} else {
+		h.counts = make([]int64, len(h.bounds)+1)
+	}
+	h.count, h.sum = 0, 0
+	h.min, h.max = math.NaN(), math.NaN()
+}
+
+// Change the percentiles the histogram reports.
+//
+// percentiles must be between 0 and 1, otherwise SetPercentiles panics
+func (h *Histogram) SetPercentiles(percentiles ...float64) {
+	checked := checkPercentiles(percentiles)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.percentiles = checked
+}
+
+// obtain the buckets in ascending order. The last fixed bucket's
+// UpperBound is +Inf; log histograms list only buckets holding values.
+func (h *Histogram) Buckets() []HistogramBucket {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.buckets()
+}
+
+// Must be called with the mutex held.
+func (h *Histogram) buckets() []HistogramBucket {
+	if h.logCounts == nil {
+		buckets := make([]HistogramBucket, len(h.counts))
+		for i, n := range h.counts {
+			bound := math.Inf(1)
+			if i < len(h.bounds) {
+				bound = h.bounds[i]
+			}
+			buckets[i] = HistogramBucket{bound, n}
+		}
+		return buckets
+	}
+
+	indexes := make([]int, 0, len(h.logCounts))
+	for k := range h.logCounts {
+		indexes = append(indexes, k)
+	}
+	sort.Ints(indexes)
+	buckets := make([]HistogramBucket, len(indexes))
+	for i, k := range indexes {
+		bound := 0.0
+		switch k {
+		case math.MinInt:
+		case math.MaxInt:
+			bound = math.Inf(1)
+		default:
+			bound = math.Pow(h.gamma, float64(k))
+		}
+		buckets[i] = HistogramBucket{bound, h.logCounts[k]}
+	}
+	return buckets
+}
+
+// obtain the estimated `percentile` of the values counted, or 0 when
+// there are none
+func (h *Histogram) Percentile(percentile float64) float64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return estimatePercentile(h.buckets(), h.gamma, h.count, h.min, h.max, percentile)
+}
+
+// estimate a percentile from bucket counts by interpolating linearly
+// within the bucket it falls in, whose ends are clamped to the
+// smallest and largest values seen. A fixed bucket starts at the one
+// before it; as log histograms skip empty buckets, with a `gamma`
+// each positive bucket starts at its UpperBound / gamma instead.
+func estimatePercentile(buckets []HistogramBucket, gamma float64, count int64, min, max, percentile float64) float64 {
+	var inBuckets int64
+	for _, b := range buckets {
+		inBuckets += b.Count
+	}
+	if inBuckets == 0 {
+		return 0.0
+	}
+	rank := percentile * float64(inBuckets)
+
+	var cum int64
+	lower := min
+	for _, b := range buckets {
+		if b.Count == 0 {
+			lower = b.UpperBound
+			continue
+		}
+		if float64(cum+b.Count) > rank || cum+b.Count == inBuckets {
+			if gamma > 0 && b.UpperBound > 0 {
+				lower = b.UpperBound / gamma
+			}
+			upper := math.Min(b.UpperBound, max)
+			lower = math.Max(lower, min)
+			if upper <= lower {
+				return upper
+			}
+			return lower + (upper-lower)*(rank-float64(cum))/float64(b.Count)
+		}
+		cum += b.Count
+		lower = b.UpperBound
+	}
+	return max
+}
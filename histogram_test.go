@@ -0,0 +1,99 @@
+package variant
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"testing"
+)
+
+func TestHistogramAsVar(t *testing.T) {
+	var _ expvar.Var = NewHistogram("", []float64{1})
+}
+
+func TestHistogramString(t *testing.T) {
+	h := NewHistogram("", []float64{1}, 0.5)
+	h.UpdateBatch([]float64{1, 2, 4})
+	want := `{"count":3,"sum":7.000000,"min":1.000000,"max":4.000000,"buckets":[{"le":1.000000,"count":1},{"le":"+Infinity","count":2}],"p50":1.750000}`
+	if got := h.String(); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	h := NewHistogram("", LinearBuckets(10, 10, 10))
+	for i := 0; i < 100; i++ {
+		h.Update(float64(i) + 0.5)
+	}
+	buckets := h.Buckets()
+	if len(buckets) != 11 || buckets[0].Count != 10 || buckets[9].Count != 10 || buckets[10].Count != 0 {
+		t.Errorf("unexpected buckets %v", buckets)
+	}
+	if p := h.Percentile(0.5); math.Abs(p-50) > 1 {
+		t.Errorf("expected p50 near 50, got %f", p)
+	}
+	if p := h.Percentile(1); p != 99.5 {
+		t.Errorf("expected p100 to be the max, 99.5, got %f", p)
+	}
+}
+
+func TestLogHistogram(t *testing.T) {
+	h := NewLogHistogram("", 0.01, 0.5, 0.99)
+	for i := 1; i <= 10000; i++ {
+		h.Update(float64(i))
+	}
+	h.Update(0)
+	for _, c := range []struct{ p, want float64 }{{0.5, 5000}, {0.99, 9900}} {
+		if got := h.Percentile(c.p); math.Abs(got-c.want)/c.want > 0.02 {
+			t.Errorf("expected p%v within 2%% of %f, got %f", c.p*100, c.want, got)
+		}
+	}
+	buckets := h.Buckets()
+	if buckets[0].UpperBound != 0 || buckets[0].Count != 1 {
+		t.Errorf("expected a zero bucket first, got %v", buckets[0])
+	}
+	if n := len(buckets); n > 500 {
+		t.Errorf("expected a few hundred buckets for four decades, got %d", n)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(h.String()), &body); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	h.Reset()
+	if b := h.Buckets(); len(b) != 0 || h.Percentile(0.5) != 0 {
+		t.Errorf("expected nothing after Reset, got %v", b)
+	}
+}
+
+func TestLogHistogramSparseBuckets(t *testing.T) {
+	h := NewLogHistogram("", 0.01, 0.5)
+	h.Update(1)
+	for i := 0; i < 100; i++ {
+		h.Update(1000)
+	}
+	if got := h.Percentile(0.5); math.Abs(got-1000)/1000 > 0.02 {
+		t.Errorf("expected p50 within 2%% of 1000, got %f", got)
+	}
+}
+
+func TestLogHistogramInfinities(t *testing.T) {
+	h := NewLogHistogram("", 0.01)
+	h.UpdateBatch([]float64{math.Inf(-1), 1, math.Inf(1)})
+	buckets := h.Buckets()
+	if len(buckets) != 3 || buckets[0].UpperBound != 0 || !math.IsInf(buckets[2].UpperBound, 1) {
+		t.Errorf("expected -Inf with zero and +Inf in its own top bucket, got %v", buckets)
+	}
+	if p := h.Percentile(1); !math.IsInf(p, 1) {
+		t.Errorf("expected p100 to be +Inf, got %f", p)
+	}
+}
+
+func TestHistogramRejectsUnsortedBounds(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for descending bounds")
+		}
+	}()
+	NewHistogram("", []float64{2, 1})
+}
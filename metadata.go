@@ -0,0 +1,101 @@
+package variant
+
+import (
+	"expvar"
+	"sync"
+)
+
+// The kind of metric a stat represents, in the vocabulary exporters
+// such as Prometheus use
+type MetricType string
+
+const (
+	MetricUntyped   MetricType = ""
+	MetricCounter   MetricType = "counter"
+	MetricGauge     MetricType = "gauge"
+	MetricSummary   MetricType = "summary"
+	MetricHistogram MetricType = "histogram"
+)
+
+// Who may see a stat. Stats are internal unless described otherwise,
+// so nothing is exposed outside the trust boundary by accident.
+type Visibility int
+
+const (
+	VisibilityInternal Visibility = iota
+	VisibilityPublic
+)
+
+// describes a published stat for consumers which want more than its
+// value, such as exporters emitting help text or dashboards labelling
+// axes
+type Metadata struct {
+	// a one line, human readable description
+	Help string
+	// what kind of metric this is; inferred from the stat if empty
+	Type MetricType
+	// the unit values are measured in, e.g. "seconds" or "bytes"
+	Unit string
+	// which handlers may serve the stat
+	Visibility Visibility
+}
+
+var metadata = struct {
+	mutex     *sync.RWMutex
+	m         map[string]Metadata
+	redactors map[string]func(string) string
+}{new(sync.RWMutex), make(map[string]Metadata), make(map[string]func(string) string)}
+
+// Attach metadata to the stat published under `name`, replacing any
+// metadata previously attached. The stat does not need to have been
+// published yet.
+func Describe(name string, md Metadata) {
+	metadata.mutex.Lock()
+	defer metadata.mutex.Unlock()
+	metadata.m[name] = md
+}
+
+// obtain the metadata attached to `name`. When no type was given it
+// is inferred from the published stat where possible.
+func MetadataFor(name string) Metadata {
+	metadata.mutex.RLock()
+	md := metadata.m[name]
+	metadata.mutex.RUnlock()
+
+	if md.Type == MetricUntyped {
+		md.Type = metricTypeOf(Get(name))
+	}
+	return md
+}
+
+// the natural metric type of a stat
+func metricTypeOf(v expvar.Var) MetricType {
+	switch v.(type) {
+	case *Int, *expvar.Int:
+		return MetricCounter
+	case *Gauge, *expvar.Float, *SimpleMovingStat, *TimedMovingStat, *Delta, *CounterRate, *ReservoirPercentile, *PercentileView, FloatFunc:
+		return MetricGauge
+	case *MovingSummary, *Timer:
+		return MetricSummary
+	case *Histogram:
+		return MetricHistogram
+	}
+	return MetricUntyped
+}
+
+// Register a hook rewriting the value of the *expvar.String published
+// under `name` before a public handler serves it, for instance to mask
+// credentials in a connection string. Internal handlers serve the
+// value untouched.
+func Redact(name string, fn func(value string) string) {
+	metadata.mutex.Lock()
+	defer metadata.mutex.Unlock()
+	metadata.redactors[name] = fn
+}
+
+// the redaction hook for `name`, or nil
+func redactorFor(name string) func(string) string {
+	metadata.mutex.RLock()
+	defer metadata.mutex.RUnlock()
+	return metadata.redactors[name]
+}
@@ -0,0 +1,37 @@
+package variant
+
+import (
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	Describe("test.metadata.latency", Metadata{
+		Help: "request latency",
+		Type: MetricSummary,
+		Unit: "seconds",
+	})
+	md := MetadataFor("test.metadata.latency")
+	if md.Help != "request latency" || md.Type != MetricSummary || md.Unit != "seconds" {
+		t.Errorf("unexpected metadata %+v", md)
+	}
+}
+
+func TestMetadataInfersType(t *testing.T) {
+	unregisterAfter(t, "test.metadata.requests", "test.metadata.depth")
+	NewInt("test.metadata.requests")
+	Describe("test.metadata.requests", Metadata{Help: "requests served"})
+	if md := MetadataFor("test.metadata.requests"); md.Type != MetricCounter {
+		t.Errorf("expected counter, got %q", md.Type)
+	}
+
+	NewGauge("test.metadata.depth")
+	if md := MetadataFor("test.metadata.depth"); md.Type != MetricGauge {
+		t.Errorf("expected gauge, got %q", md.Type)
+	}
+}
+
+func TestMetadataUnknown(t *testing.T) {
+	if md := MetadataFor("test.metadata.missing"); md != (Metadata{}) {
+		t.Errorf("expected empty metadata, got %+v", md)
+	}
+}
@@ -0,0 +1,174 @@
+package variant
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how often a Meter folds the events marked since into its averages
+const meterTick = 5 * time.Second
+
+// an exponentially weighted moving average of a per-second rate,
+// updated once per meterTick
+type ewma struct {
+	alpha  float64
+	rate   float64
+	primed bool
+}
+
+// an ewma which mostly forgets events older than `over`, as the
+// load averages do
+func newEWMA(over time.Duration) ewma {
+	return ewma{alpha: 1 - math.Exp(-meterTick.Seconds()/over.Seconds())}
+}
+
+// fold in the `n` events seen during one tick
+func (e *ewma) tick(n int64) {
+	instant := float64(n) / meterTick.Seconds()
+	if !e.primed {
+		e.rate = instant
+		e.primed = true
+		return
+	}
+	e.rate += e.alpha * (instant - e.rate)
+}
+
+// fold in `ticks` ticks without events at once
+func (e *ewma) idle(ticks int64) {
+	e.rate *= math.Pow(1-e.alpha, float64(ticks))
+}
+
+// represents how often something happens: the total count, the mean
+// rate since creation, and exponentially weighted 1, 5 and 15 minute
+// rates, per second
+// it is thread/goroutine safe
+type Meter struct {
+	mutex     *sync.Mutex
+	count     int64
+	uncounted int64
+	m1        ewma
+	m5        ewma
+	m15       ewma
+	start     time.Time
+	lastTick  time.Time
+	now       func() time.Time
+}
+
+// the rates of a Meter at one moment, all per second
+type MeterRates struct {
+	Count  int64
+	Rate1  float64
+	Rate5  float64
+	Rate15 float64
+	Mean   float64
+}
+
+// Create a new meter expvar.Var. It will be published under `name`
+// and render as a JSON object such as
+//
+//	{"count":1200,"m1":19.800000,"m5":19.960000,"m15":19.990000,"mean":20.000000}
+//
+// The moving rates advance every five seconds, so they trail the
+// events marked by up to that long.
+//
+// An empty name will cause it to not be published.
+func NewMeter(name string) *Meter {
+	m := new(Meter)
+	m.mutex = new(sync.Mutex)
+	m.now = time.Now
+	m.reset()
+	publish(name, m)
+	return m
+}
+
+// display the rates as a JSON object
+func (m *Meter) String() string {
+	rates := m.Rates()
+
+	var b strings.Builder
+	b.WriteString(`{"count":`)
+	b.WriteString(strconv.FormatInt(rates.Count, 10))
+	b.WriteString(`,"m1":`)
+	b.WriteString(formatFloat(rates.Rate1))
+	b.WriteString(`,"m5":`)
+	b.WriteString(formatFloat(rates.Rate5))
+	b.WriteString(`,"m15":`)
+	b.WriteString(formatFloat(rates.Rate15))
+	b.WriteString(`,"mean":`)
+	b.WriteString(formatFloat(rates.Mean))
+	b.WriteString("}")
+	return b.String()
+}
+
+// record `n` events
+func (m *Meter) Mark(n int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.advance()
+	m.count += n
+	m.uncounted += n
+}
+
+// obtain the number of events marked
+func (m *Meter) Count() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.count
+}
+
+// obtain the current rates
+func (m *Meter) Rates() MeterRates {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.advance()
+
+	rates := MeterRates{
+		Count:  m.count,
+		Rate1:  m.m1.rate,
+		Rate5:  m.m5.rate,
+		Rate15: m.m15.rate,
+	}
+	if elapsed := m.now().Sub(m.start).Seconds(); elapsed > 0 {
+		rates.Mean = float64(m.count) / elapsed
+	}
+	return rates
+}
+
+// Discard every event marked and start measuring afresh
+func (m *Meter) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.reset()
+}
+
+// start measuring from nothing. Must be called with the mutex held.
+func (m *Meter) reset() {
+	m.count = 0
+	m.uncounted = 0
+	m.m1 = newEWMA(time.Minute)
+	m.m5 = newEWMA(5 * time.Minute)
+	m.m15 = newEWMA(15 * time.Minute)
+	m.start = m.now()
+	m.lastTick = m.start
+}
+
+// fold in every tick which has passed since the last one. Must be
+// called with the mutex held.
+func (m *Meter) advance() {
+	ticks := int64(m.now().Sub(m.lastTick) / meterTick)
+	if ticks <= 0 {
+		return
+	}
+	m.lastTick = m.lastTick.Add(time.Duration(ticks) * meterTick)
+
+	// everything uncounted happened during the first tick; after a
+	// long idle spell the rest decay in one step rather than a loop
+	for _, e := range []*ewma{&m.m1, &m.m5, &m.m15} {
+		e.tick(m.uncounted)
+		e.idle(ticks - 1)
+	}
+	m.uncounted = 0
+}
@@ -0,0 +1,74 @@
+package variant
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"testing"
+	"time"
+)
+
+func newTestMeter() (*Meter, *fakeClock) {
+	clock := &fakeClock{time.Unix(1000, 0)}
+	m := NewMeter("")
+	m.now = clock.now
+	m.Reset()
+	return m, clock
+}
+
+func TestMeterAsVar(t *testing.T) {
+	var _ expvar.Var = NewMeter("")
+}
+
+func TestMeterSteadyRate(t *testing.T) {
+	m, clock := newTestMeter()
+	// 20/s for half an hour
+	for i := 0; i < 1800; i++ {
+		m.Mark(20)
+		clock.advance(time.Second)
+	}
+	rates := m.Rates()
+	if rates.Count != 36000 {
+		t.Errorf("expected a count of 36000, got %d", rates.Count)
+	}
+	for name, rate := range map[string]float64{"m1": rates.Rate1, "m5": rates.Rate5, "m15": rates.Rate15, "mean": rates.Mean} {
+		if math.Abs(rate-20) > 0.5 {
+			t.Errorf("expected %s of about 20/s, got %f", name, rate)
+		}
+	}
+}
+
+func TestMeterDecays(t *testing.T) {
+	m, clock := newTestMeter()
+	for i := 0; i < 600; i++ {
+		m.Mark(10)
+		clock.advance(time.Second)
+	}
+	clock.advance(5 * time.Minute)
+	rates := m.Rates()
+	if !(rates.Rate1 < 0.1) {
+		t.Errorf("expected the 1 minute rate to have decayed, got %f", rates.Rate1)
+	}
+	if !(rates.Rate1 < rates.Rate5 && rates.Rate5 < rates.Rate15) {
+		t.Errorf("expected longer rates to decay slower, got %+v", rates)
+	}
+}
+
+func TestMeterString(t *testing.T) {
+	m, clock := newTestMeter()
+	m.Mark(50)
+	clock.advance(10 * time.Second)
+
+	var body map[string]float64
+	if err := json.Unmarshal([]byte(m.String()), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", m.String(), err)
+	}
+	if body["count"] != 50 || body["mean"] != 5 || body["m1"] <= 0 {
+		t.Errorf("unexpected rates %v", body)
+	}
+
+	m.Reset()
+	if rates := m.Rates(); rates.Count != 0 || rates.Rate1 != 0 {
+		t.Errorf("expected nothing after Reset, got %+v", rates)
+	}
+}
@@ -0,0 +1,113 @@
+package variant
+
+import (
+	"time"
+)
+
+// obtain the `percentile` of the values in the window, whatever the
+// stat reports. The first call on an average or another stat without
+// an order statistic tree builds one, O(n log n), which its updates
+// then maintain, O(log n) each.
+//
+// percentile must be between 0 and 1, otherwise Percentile panics
+func (s *SimpleMovingStat) Percentile(percentile float64) float64 {
+	return s.Percentiles(percentile)[0]
+}
+
+// obtain several percentiles of the values in the window at once, in
+// the order asked for, from one consistent view of it. See Percentile.
+//
+// percentiles must be between 0 and 1, otherwise Percentiles panics
+func (s *SimpleMovingStat) Percentiles(percentiles ...float64) []float64 {
+	checkPercentiles(percentiles)
+	s.collect()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.rank()
+
+	values := make([]float64, len(percentiles))
+	for i, p := range percentiles {
+		values[i] = s.tree.percentile(p)
+	}
+	return values
+}
+
+// build the order statistic tree if the stat has none. Must be called
+// with the mutex held.
+func (s *SimpleMovingStat) rank() {
+	if s.tree != nil {
+		return
+	}
+	s.tree = newOrderTree(s.size)
+	s.values.Do(func(val interface{}) {
+		if val != nil {
+			s.tree.insert(val.(float64))
+		}
+	})
+}
+
+// Create a window of `size` values and publish a percentile of it
+// under each name in `percentiles`, e.g.
+//
+//	latency := variant.NewMovingPercentiles(1000, map[string]float64{
+//		"db.latency.p50": 0.50,
+//		"db.latency.p99": 0.99,
+//	})
+//	latency.Update(ms)
+//
+// Every percentile reads the one window, so each value is stored, and
+// each update ordered, once however many are published. The window
+// itself is not published; its own Value is the average.
+//
+// percentiles must be between 0 and 1
+func NewMovingPercentiles(size int, percentiles map[string]float64) *SimpleMovingStat {
+	s := NewSimpleMovingAverage("", size)
+	s.mutex.Lock()
+	s.rank()
+	s.mutex.Unlock()
+
+	for name, p := range percentiles {
+		checkPercentiles([]float64{p})
+		publish(name, &PercentileView{s, p})
+	}
+	return s
+}
+
+// represents one percentile of a window which other stats may share,
+// as published by NewMovingPercentiles
+// it is thread/goroutine safe
+type PercentileView struct {
+	stat       *SimpleMovingStat
+	percentile float64
+}
+
+// display the value as a string
+func (v *PercentileView) String() string {
+	return formatFloat(v.Value())
+}
+
+// obtain the current value
+func (v *PercentileView) Value() float64 {
+	return v.stat.Percentile(v.percentile)
+}
+
+// obtain the percentile reported, which a view always has
+func (v *PercentileView) ReportedPercentile() (float64, bool) {
+	return v.percentile, true
+}
+
+// obtain a copy of the values in the shared window, oldest first
+func (v *PercentileView) Values() []float64 {
+	return v.stat.Values()
+}
+
+// render the value as JSON, the same as String
+func (v *PercentileView) MarshalJSON() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// take a copy of the shared window and the percentile of it
+func (v *PercentileView) Snapshot() Snapshot {
+	values := v.stat.Values()
+	return Snapshot{Time: time.Now(), Count: int64(len(values)), Value: v.Value(), Values: values}
+}
@@ -0,0 +1,58 @@
+package variant
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestPercentileOfAverage(t *testing.T) {
+	s := NewSimpleMovingAverage("", 100)
+	for i := 1; i <= 100; i++ {
+		s.Update(float64(i))
+	}
+	got := s.Percentiles(0.5, 0.95, 0.99)
+	if got[0] != 51 || got[1] != 96 || got[2] != 100 {
+		t.Errorf("expected [51 96 100], got %v", got)
+	}
+	// the tree built on demand keeps up with later updates
+	s.Update(1000)
+	if p := s.Percentile(1); p != 1000 {
+		t.Errorf("expected the max to be 1000, got %f", p)
+	}
+	if avg := s.Value(); avg != 60.49 {
+		t.Errorf("expected the average to be unaffected, 60.49, got %f", avg)
+	}
+	if problems := s.Audit(); len(problems) != 0 {
+		t.Errorf("unexpected findings %v", problems)
+	}
+}
+
+func TestNewMovingPercentiles(t *testing.T) {
+	unregisterAfter(t, "test.shared.p50", "test.shared.p90")
+	s := NewMovingPercentiles(10, map[string]float64{
+		"test.shared.p50": 0.5,
+		"test.shared.p90": 0.9,
+	})
+	for i := 1; i <= 10; i++ {
+		s.Update(float64(i))
+	}
+	if v := expvar.Get("test.shared.p50").String(); v != "6.000000" {
+		t.Errorf("expected p50 of 6.000000, got %s", v)
+	}
+	if v := expvar.Get("test.shared.p90").String(); v != "10.000000" {
+		t.Errorf("expected p90 of 10.000000, got %s", v)
+	}
+	view := Get("test.shared.p90").(*PercentileView)
+	if n := len(view.Values()); n != 10 {
+		t.Errorf("expected the view to share the 10 value window, got %d", n)
+	}
+}
+
+func TestPercentilesRejectsBadPercentile(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a negative percentile")
+		}
+	}()
+	NewSimpleMovingAverage("", 3).Percentile(-0.1)
+}
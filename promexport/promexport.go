@@ -0,0 +1,284 @@
+/*
+Package promexport serves variant stats in the Prometheus text
+exposition format, so they can be scraped without a bridge.
+*/
+package promexport
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brianm/variant"
+)
+
+// Create a handler serving every published variant stat at least as
+// visible as `level` in the Prometheus text format, version 0.0.4.
+// Help text, types and units come from variant.Describe.
+//
+// Names have every character Prometheus does not allow replaced by an
+// underscore, and the unit appended, so "db.latency" with unit
+// "seconds" becomes db_latency_seconds. Stats map onto metrics as
+// follows:
+//
+//	Int, expvar.Int          counter
+//	Gauge, expvar.Float,     gauge
+//	FloatFunc, CounterRate,
+//	averages, minima, maxima
+//	percentile stats,        summary with a single quantile
+//	ReservoirPercentile,
+//	PercentileView
+//	MovingSummary, Timer     summary with a quantile per percentile,
+//	                         and _sum and _count over the window
+//	StatFamily               as its children, labelled with their
+//	                         label names and values
+//	Histogram                histogram with cumulative buckets
+//	WindowedCounter          <name>_total counter, and <name>_window
+//	                         and <name>_rate gauges
+//	Meter                    <name>_total counter, and <name>_rate
+//	                         gauges labelled window="1m", "5m", "15m"
+//	                         and "mean"
+//
+// Delta is left out, as scraping it would steal its value from its
+// one reader, as are vars of other types.
+//
+// Responses support gzip and conditional requests, see
+// variant.ConditionalHandler.
+func Handler(level variant.Visibility) http.Handler {
+	return variant.ConditionalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		Write(&buf, level)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	}))
+}
+
+// Write every published variant stat at least as visible as `level`
+// to `w` in the Prometheus text format, as Handler serves them
+func Write(w io.Writer, level variant.Visibility) {
+	variant.Do(func(kv expvar.KeyValue) {
+		md := variant.MetadataFor(kv.Key)
+		if md.Visibility < level {
+			return
+		}
+		writeVar(w, metricName(kv.Key, md.Unit), md, kv.Value)
+	})
+}
+
+// write one var, if it is of a type which maps onto a metric
+func writeVar(w io.Writer, name string, md variant.Metadata, v expvar.Var) {
+	switch v := v.(type) {
+	case *variant.Int:
+		writeSample(w, name, md, "counter", float64(v.Value()))
+	case *expvar.Int:
+		writeSample(w, name, md, "counter", float64(v.Value()))
+	case *variant.Gauge:
+		writeSample(w, name, md, "gauge", v.Value())
+	case *expvar.Float:
+		writeSample(w, name, md, "gauge", v.Value())
+	case *variant.CounterRate:
+		writeSample(w, name, md, "gauge", v.Value())
+	case variant.FloatFunc:
+		writeSample(w, name, md, "gauge", v.Value())
+	case *variant.SimpleMovingStat:
+		writeMoving(w, name, md, v)
+	case *variant.TimedMovingStat:
+		writeMoving(w, name, md, v)
+	case *variant.ReservoirPercentile:
+		writeMoving(w, name, md, v)
+	case *variant.PercentileView:
+		writeMoving(w, name, md, v)
+	case *variant.MovingSummary:
+		writeSummary(w, name, md, v.Summary())
+	case *variant.Timer:
+		writeSummary(w, name, md, v.Summary())
+	case *variant.Meter:
+		writeMeter(w, name, md, v.Rates())
+	case *variant.Histogram:
+		writeHistogram(w, name, md, v)
+	case *variant.WindowedCounter:
+		writeWindowed(w, name, md, v.Counts())
+	case *variant.StatFamily:
+		writeFamily(w, name, md, v)
+	}
+}
+
+// a moving average or percentile
+type movingStat interface {
+	Value() float64
+	ReportedPercentile() (float64, bool)
+}
+
+func writeMoving(w io.Writer, name string, md variant.Metadata, s movingStat) {
+	p, ok := s.ReportedPercentile()
+	if !ok {
+		writeSample(w, name, md, "gauge", s.Value())
+		return
+	}
+	writeHeader(w, name, md, "summary")
+	fmt.Fprintf(w, "%s{quantile=%q} %s\n", name, formatFloat(p), formatFloat(s.Value()))
+}
+
+func writeFamily(w io.Writer, name string, md variant.Metadata, f *variant.StatFamily) {
+	labelNames := f.LabelNames()
+	header := false
+	f.Each(func(values []string, s *variant.SimpleMovingStat) {
+		pairs := make([]string, len(values))
+		for i, value := range values {
+			pairs[i] = sanitize(labelNames[i]) + `="` + labelEscaper.Replace(value) + `"`
+		}
+		labels := strings.Join(pairs, ",")
+
+		p, ok := s.ReportedPercentile()
+		if !header {
+			typ := "gauge"
+			if ok {
+				typ = "summary"
+			} else if md.Type != variant.MetricUntyped {
+				typ = string(md.Type)
+			}
+			writeHeader(w, name, md, typ)
+			header = true
+		}
+		if ok {
+			labels += `,quantile="` + formatFloat(p) + `"`
+		}
+		fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatFloat(s.Value()))
+	})
+}
+
+// escapes a label value as the text format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeSummary(w io.Writer, name string, md variant.Metadata, sum variant.Summary) {
+	writeHeader(w, name, md, "summary")
+
+	// Prometheus expects quantiles in ascending order
+	order := make([]int, len(sum.Percentiles))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return sum.Percentiles[order[a]] < sum.Percentiles[order[b]]
+	})
+	for _, i := range order {
+		fmt.Fprintf(w, "%s{quantile=%q} %s\n", name, formatFloat(sum.Percentiles[i]), formatFloat(sum.Quantiles[i]))
+	}
+
+	total := 0.0
+	if sum.Count > 0 {
+		total = sum.Mean * float64(sum.Count)
+	}
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(total))
+	fmt.Fprintf(w, "%s_count %d\n", name, sum.Count)
+}
+
+func writeHistogram(w io.Writer, name string, md variant.Metadata, h *variant.Histogram) {
+	snap := h.Snapshot()
+	buckets := h.Buckets()
+	writeHeader(w, name, md, "histogram")
+	var cum int64
+	for _, b := range buckets {
+		cum += b.Count
+		if !math.IsInf(b.UpperBound, 1) {
+			fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, formatFloat(b.UpperBound), cum)
+		}
+	}
+	// NaN values are counted but in no bucket, so +Inf covers the
+	// buckets rather than the count
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, cum)
+	fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(snap.Fields["sum"]))
+	fmt.Fprintf(w, "%s_count %d\n", name, cum)
+}
+
+func writeWindowed(w io.Writer, name string, md variant.Metadata, counts variant.WindowedCount) {
+	writeHeader(w, name+"_total", md, "counter")
+	fmt.Fprintf(w, "%s_total %d\n", name, counts.Total)
+	writeHeader(w, name+"_window", md, "gauge")
+	fmt.Fprintf(w, "%s_window %d\n", name, counts.Count)
+	writeHeader(w, name+"_rate", md, "gauge")
+	fmt.Fprintf(w, "%s_rate %s\n", name, formatFloat(counts.Rate))
+}
+
+func writeMeter(w io.Writer, name string, md variant.Metadata, rates variant.MeterRates) {
+	writeHeader(w, name+"_total", md, "counter")
+	fmt.Fprintf(w, "%s_total %d\n", name, rates.Count)
+
+	writeHeader(w, name+"_rate", md, "gauge")
+	for _, r := range []struct {
+		window string
+		rate   float64
+	}{{"1m", rates.Rate1}, {"5m", rates.Rate5}, {"15m", rates.Rate15}, {"mean", rates.Mean}} {
+		fmt.Fprintf(w, "%s_rate{window=%q} %s\n", name, r.window, formatFloat(r.rate))
+	}
+}
+
+// write a metric with a single unlabelled sample. The type attached
+// with variant.Describe, if any, overrides `typ`.
+func writeSample(w io.Writer, name string, md variant.Metadata, typ string, value float64) {
+	if md.Type != variant.MetricUntyped {
+		typ = string(md.Type)
+	}
+	writeHeader(w, name, md, typ)
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+// write the HELP and TYPE lines of a metric
+func writeHeader(w io.Writer, name string, md variant.Metadata, typ string) {
+	if md.Help != "" {
+		help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(md.Help)
+		fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// the Prometheus metric name for the var `key` measured in `unit`
+func metricName(key, unit string) string {
+	name := sanitize(key)
+	if unit != "" {
+		suffix := "_" + sanitize(unit)
+		if !strings.HasSuffix(name, suffix) {
+			name += suffix
+		}
+	}
+	return name
+}
+
+// replace every character not allowed in a metric name with an
+// underscore
+func sanitize(s string) string {
+	var b strings.Builder
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+			b.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// render a float as Prometheus does
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,140 @@
+package promexport
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brianm/variant"
+)
+
+func scrape(t *testing.T, level variant.Visibility) string {
+	rec := httptest.NewRecorder()
+	Handler(level).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	return rec.Body.String()
+}
+
+// unregister `names` from the default registry once the test ends, so
+// the tests can run more than once
+func unregisterAfter(t *testing.T, names ...string) {
+	t.Cleanup(func() {
+		for _, name := range names {
+			variant.DefaultRegistry.Unregister(name)
+		}
+	})
+}
+
+func expectLines(t *testing.T, body string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in\n%s", line, body)
+		}
+	}
+}
+
+func TestWriteValues(t *testing.T) {
+	unregisterAfter(t, "test.prom.requests", "test.prom.queue", "test.prom.latency")
+	variant.NewInt("test.prom.requests").Add(3)
+	variant.NewGauge("test.prom.queue").Set(1.5)
+	variant.Describe("test.prom.latency", variant.Metadata{Help: "db latency", Unit: "seconds"})
+	variant.NewSimpleMovingAverage("test.prom.latency", 10).UpdateBatch([]float64{1, 2})
+
+	expectLines(t, scrape(t, variant.VisibilityInternal),
+		"# TYPE test_prom_requests counter",
+		"test_prom_requests 3",
+		"# TYPE test_prom_queue gauge",
+		"test_prom_queue 1.5",
+		"# HELP test_prom_latency_seconds db latency",
+		"# TYPE test_prom_latency_seconds gauge",
+		"test_prom_latency_seconds 1.5",
+	)
+}
+
+func TestWriteQuantiles(t *testing.T) {
+	unregisterAfter(t, "test.prom.p99", "test.prom.summary")
+	p := variant.NewSimpleMovingPercentile("test.prom.p99", 0.99, 100)
+	s := variant.NewMovingSummary("test.prom.summary", 100, 0.99, 0.5)
+	for i := 1; i <= 100; i++ {
+		p.Update(float64(i))
+		s.Update(float64(i))
+	}
+
+	expectLines(t, scrape(t, variant.VisibilityInternal),
+		"# TYPE test_prom_p99 summary",
+		`test_prom_p99{quantile="0.99"} 100`,
+		"# TYPE test_prom_summary summary",
+		`test_prom_summary{quantile="0.5"} 51`+"\n"+`test_prom_summary{quantile="0.99"} 100`,
+		"test_prom_summary_sum 5050",
+		"test_prom_summary_count 100",
+	)
+}
+
+func TestWriteMeter(t *testing.T) {
+	unregisterAfter(t, "test.prom.meter")
+	variant.NewMeter("test.prom.meter").Mark(7)
+	expectLines(t, scrape(t, variant.VisibilityInternal),
+		"# TYPE test_prom_meter_total counter",
+		"test_prom_meter_total 7",
+		"# TYPE test_prom_meter_rate gauge",
+		`test_prom_meter_rate{window="1m"} 0`,
+	)
+}
+
+func TestWriteVisibility(t *testing.T) {
+	unregisterAfter(t, "test.prom.secret", "test.prom.public")
+	variant.NewGauge("test.prom.secret").Set(1)
+	variant.Describe("test.prom.public", variant.Metadata{Visibility: variant.VisibilityPublic})
+	variant.NewTimer("test.prom.public", time.Millisecond, 10)
+
+	var buf bytes.Buffer
+	Write(&buf, variant.VisibilityPublic)
+	body := buf.String()
+	if strings.Contains(body, "test_prom_secret") {
+		t.Errorf("expected internal stats to be left out of\n%s", body)
+	}
+	expectLines(t, body, "test_prom_public_count 0")
+}
+
+func TestMetricName(t *testing.T) {
+	for key, want := range map[string]string{
+		"db.latency":   "db_latency",
+		"1st-try":      "_1st_try",
+		"ok:name_here": "ok:name_here",
+	} {
+		if got := metricName(key, ""); got != want {
+			t.Errorf("expected %q for %q, got %q", want, key, got)
+		}
+	}
+	if got := metricName("rx_bytes", "bytes"); got != "rx_bytes" {
+		t.Errorf("expected the unit not to be repeated, got %q", got)
+	}
+}
+
+func TestWriteFamily(t *testing.T) {
+	unregisterAfter(t, "test.prom.family")
+	f := variant.NewMovingPercentileFamily("test.prom.family", 0.5, 10, "method", "path")
+	f.WithLabels("GET", `/a"b`).Update(2)
+
+	expectLines(t, scrape(t, variant.VisibilityInternal),
+		"# TYPE test_prom_family summary",
+		`test_prom_family{method="GET",path="/a\"b",quantile="0.5"} 2`,
+	)
+}
+
+func TestWriteHistogram(t *testing.T) {
+	unregisterAfter(t, "test.prom.hist")
+	variant.NewHistogram("test.prom.hist", []float64{1, 2}).UpdateBatch([]float64{0.5, 1.5, 3})
+	expectLines(t, scrape(t, variant.VisibilityInternal),
+		"# TYPE test_prom_hist histogram",
+		`test_prom_hist_bucket{le="1"} 1`,
+		`test_prom_hist_bucket{le="2"} 2`,
+		`test_prom_hist_bucket{le="+Inf"} 3`,
+		"test_prom_hist_sum 5",
+		"test_prom_hist_count 3",
+	)
+}
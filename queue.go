@@ -0,0 +1,120 @@
+package variant
+
+import (
+	"sync/atomic"
+)
+
+// a node in an updateQueue
+type updateNode struct {
+	next atomic.Pointer[updateNode]
+	val  float64
+}
+
+// An unbounded lock-free multi-producer single-consumer queue of
+// updates, after Dmitry Vyukov's intrusive MPSC node queue. Any number
+// of goroutines may push, only the drain goroutine may pop.
+type updateQueue struct {
+	head    atomic.Pointer[updateNode]
+	tail    *updateNode
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newUpdateQueue() *updateQueue {
+	q := new(updateQueue)
+	stub := new(updateNode)
+	q.head.Store(stub)
+	q.tail = stub
+	q.wake = make(chan struct{}, 1)
+	q.done = make(chan struct{})
+	q.stopped = make(chan struct{})
+	return q
+}
+
+// enqueue a value and nudge the consumer, never blocks
+func (q *updateQueue) push(val float64) {
+	n := &updateNode{val: val}
+	prev := q.head.Swap(n)
+	prev.next.Store(n)
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dequeue a value, reporting false when the queue is empty. A push
+// which has swapped the head but not yet linked its node also reads
+// as empty; the pusher's wake-up makes the consumer look again.
+func (q *updateQueue) pop() (float64, bool) {
+	next := q.tail.next.Load()
+	if next == nil {
+		return 0, false
+	}
+	q.tail = next
+	return next.val, true
+}
+
+// Switch the stat into asynchronous mode: Update pushes onto a
+// lock-free queue and returns, while a single background goroutine
+// drains the queue into the window. Producers never contend on the
+// stat's mutex, at the cost of reads lagging the most recent updates
+// by however long the drain takes.
+//
+// Calling StartAsync on a stat which is already asynchronous does
+// nothing.
+func (s *SimpleMovingStat) StartAsync() {
+	q := newUpdateQueue()
+	if !s.queue.CompareAndSwap(nil, q) {
+		return
+	}
+	go s.drain(q)
+}
+
+// Return the stat to synchronous updates. Values already queued are
+// applied before StopAsync returns; an Update racing with StopAsync
+// may still land on the old queue and be dropped, so quiesce
+// producers first if every sample matters.
+func (s *SimpleMovingStat) StopAsync() {
+	q := s.queue.Swap(nil)
+	if q == nil {
+		return
+	}
+	close(q.done)
+	<-q.stopped
+}
+
+// the background consumer started by StartAsync
+func (s *SimpleMovingStat) drain(q *updateQueue) {
+	defer close(q.stopped)
+	for {
+		select {
+		case <-q.wake:
+			s.apply(q)
+		case <-q.done:
+			s.apply(q)
+			return
+		}
+	}
+}
+
+// move everything currently queued into the window under one lock
+func (s *SimpleMovingStat) apply(q *updateQueue) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := 0
+	for {
+		val, ok := q.pop()
+		if !ok {
+			break
+		}
+		s.insert(val)
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	s.updated(n)
+}
@@ -0,0 +1,79 @@
+package variant
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestQueueOrder(t *testing.T) {
+	q := newUpdateQueue()
+	q.push(1)
+	q.push(2)
+	q.push(3)
+	for _, want := range []float64{1, 2, 3} {
+		val, ok := q.pop()
+		if !ok || val != want {
+			t.Errorf("expected %f, got %f (ok=%v)", want, val, ok)
+		}
+	}
+	if _, ok := q.pop(); ok {
+		t.Errorf("expected empty queue")
+	}
+}
+
+func TestAsyncUpdates(t *testing.T) {
+	s := NewSimpleMovingAverage("", 1000)
+	s.StartAsync()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Update(2)
+			}
+		}()
+	}
+	wg.Wait()
+	s.StopAsync()
+
+	if n := len(s.Values()); n != 400 {
+		t.Errorf("expected 400 values, got %d", n)
+	}
+	if avg := s.Value(); avg != 2.0 {
+		t.Errorf("expected avg of 2.0, got %f", avg)
+	}
+}
+
+func TestStopAsyncRestoresSyncUpdates(t *testing.T) {
+	s := NewSimpleMovingAverage("", 3)
+	s.StartAsync()
+	s.StartAsync()
+	s.StopAsync()
+	s.StopAsync()
+	s.Update(5)
+	if avg := s.Value(); avg != 5.0 {
+		t.Errorf("expected avg of 5.0, got %f", avg)
+	}
+}
+
+func BenchmarkUpdateSync(b *testing.B) {
+	s := NewSimpleMovingAverage("", 100)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.Update(1)
+		}
+	})
+}
+
+func BenchmarkUpdateAsync(b *testing.B) {
+	s := NewSimpleMovingAverage("", 100)
+	s.StartAsync()
+	defer s.StopAsync()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.Update(1)
+		}
+	})
+}
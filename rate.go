@@ -0,0 +1,98 @@
+package variant
+
+import (
+	"sync"
+	"time"
+)
+
+// how finely a CounterRate divides its window; reads within
+// window/rateResolution of the second newest sample overwrite the
+// newest one, bounding the samples kept to about twice this
+const rateResolution = 64
+
+// a reading of a CounterRate's reset-adjusted total
+type rateSample struct {
+	at    time.Time
+	total int64
+}
+
+// represents the per-second rate of a monotonic counter averaged over
+// a sliding window of time
+// it is thread/goroutine safe
+type CounterRate struct {
+	mutex   *sync.Mutex
+	source  IntSource
+	window  time.Duration
+	last    int64
+	total   int64
+	samples []rateSample
+	now     func() time.Time
+}
+
+// Create a new counter rate expvar.Var. It will be published under
+// `name` and report how fast `source` grew, per second, over the
+// trailing `window`.
+//
+// The counter is sampled whenever the rate is read, so the rate
+// covers the span between the oldest read still inside the window
+// and now. If the counter goes backwards it is assumed to have been
+// reset and counting continues from its new value.
+//
+// An empty name will cause it to not be published.
+func NewCounterRate(name string, source IntSource, window time.Duration) *CounterRate {
+	r := new(CounterRate)
+	r.mutex = new(sync.Mutex)
+	r.source = source
+	r.window = window
+	r.now = time.Now
+	r.last = source.Value()
+	r.samples = append(r.samples, rateSample{r.now(), 0})
+	publish(name, r)
+	return r
+}
+
+// display the value as a string
+func (r *CounterRate) String() string {
+	return formatFloat(r.Value())
+}
+
+// obtain the current per-second rate
+func (r *CounterRate) Value() float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.now()
+	cur := r.source.Value()
+	if cur < r.last {
+		r.total += cur
+	} else {
+		r.total += cur - r.last
+	}
+	r.last = cur
+
+	// the newest sample is the moving end of a bucket which starts at
+	// the one before it, so frequent reads extend it rather than pile
+	// up, while the bucket start stays put as the window slides past
+	sample := rateSample{now, r.total}
+	n := len(r.samples)
+	if n > 1 && now.Sub(r.samples[n-2].at) < r.window/rateResolution {
+		r.samples[n-1] = sample
+	} else {
+		r.samples = append(r.samples, sample)
+	}
+
+	// keep the newest sample at or before the cutoff as the baseline
+	cutoff := now.Add(-r.window)
+	drop := 0
+	for drop+1 < len(r.samples) && !r.samples[drop+1].at.After(cutoff) {
+		drop++
+	}
+	r.samples = append(r.samples[:0], r.samples[drop:]...)
+
+	oldest := r.samples[0]
+	elapsed := now.Sub(oldest.at).Seconds()
+	if elapsed <= 0 {
+		return 0.0
+	}
+	return float64(r.total-oldest.total) / elapsed
+}
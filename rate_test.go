@@ -0,0 +1,106 @@
+package variant
+
+import (
+	"testing"
+	"time"
+)
+
+// a clock which only moves when told to
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestRate(source IntSource, window time.Duration) (*CounterRate, *fakeClock) {
+	clock := &fakeClock{time.Unix(1000, 0)}
+	r := NewCounterRate("", source, window)
+	r.now = clock.now
+	r.samples[0].at = clock.t
+	return r, clock
+}
+
+func TestCounterRate(t *testing.T) {
+	c := NewInt("")
+	r, clock := newTestRate(c, time.Minute)
+
+	clock.advance(10 * time.Second)
+	c.Add(50)
+	if v := r.Value(); v != 5.0 {
+		t.Errorf("expected 5.0/s, got %f", v)
+	}
+}
+
+func TestCounterRateSlides(t *testing.T) {
+	c := NewInt("")
+	r, clock := newTestRate(c, 10*time.Second)
+
+	clock.advance(10 * time.Second)
+	c.Add(100)
+	r.Value()
+
+	// nothing happens for the next window, so the rate decays to zero
+	clock.advance(10 * time.Second)
+	if v := r.Value(); v != 0.0 {
+		t.Errorf("expected 0.0/s, got %f", v)
+	}
+}
+
+func TestCounterRateReset(t *testing.T) {
+	c := NewInt("")
+	c.Add(1000)
+	r, clock := newTestRate(c, time.Minute)
+
+	clock.advance(10 * time.Second)
+	c.Add(-1000)
+	c.Add(20)
+	if v := r.Value(); v != 2.0 {
+		t.Errorf("expected 2.0/s, got %f", v)
+	}
+}
+
+func TestCounterRateBoundedSamples(t *testing.T) {
+	c := NewInt("")
+	r, clock := newTestRate(c, time.Minute)
+	for i := 0; i < 10000; i++ {
+		clock.advance(10 * time.Millisecond)
+		c.Inc()
+		r.Value()
+	}
+	if n := len(r.samples); n > 2*rateResolution+2 {
+		t.Errorf("expected at most %d samples, got %d", 2*rateResolution+2, n)
+	}
+	if v := r.Value(); v < 99.0 || v > 101.0 {
+		t.Errorf("expected about 100.0/s, got %f", v)
+	}
+}
+
+func TestCounterRateFrequentReadsSlide(t *testing.T) {
+	c := NewInt("")
+	r, clock := newTestRate(c, time.Minute)
+
+	// ten busy minutes at 1000/s, read every 100ms
+	for i := 0; i < 6000; i++ {
+		clock.advance(100 * time.Millisecond)
+		c.Add(100)
+		r.Value()
+	}
+	if v := r.Value(); v < 999.0 || v > 1001.0 {
+		t.Errorf("expected about 1000.0/s while busy, got %f", v)
+	}
+
+	// then ten idle minutes, still read every 100ms
+	for i := 0; i < 6000; i++ {
+		clock.advance(100 * time.Millisecond)
+		r.Value()
+	}
+	if v := r.Value(); v != 0.0 {
+		t.Errorf("expected 0.0/s once idle for a window, got %f", v)
+	}
+}
@@ -0,0 +1,116 @@
+package variant
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// a snapshot of every published var
+type frame struct {
+	at   time.Time
+	vars []byte
+}
+
+// FlightRecorder keeps the last few snapshots of every published var
+// in memory, e.g. one per second for ten minutes, so that after an
+// incident the recent history can be pulled from the still running
+// process. As an http.Handler it serves the retained snapshots, oldest
+// first, as a JSON array of {"time": ..., "vars": {...}} objects.
+//
+// Snapshots include internal vars, so serve it only on an internal
+// endpoint. Deltas are left out, since rendering one every tick would
+// steal the increase from scrapers.
+type FlightRecorder struct {
+	mutex   *sync.Mutex
+	frames  []frame
+	next    int
+	full    bool
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Create a new FlightRecorder taking a snapshot every `interval` and
+// retaining the latest `n`. Call Stop when done with it to release
+// the background goroutine.
+//
+// It panics if `interval` or `n` is not positive.
+func NewFlightRecorder(interval time.Duration, n int) *FlightRecorder {
+	if interval <= 0 {
+		panic("variant: non-positive interval for NewFlightRecorder")
+	}
+	if n <= 0 {
+		panic("variant: non-positive snapshot count for NewFlightRecorder")
+	}
+	f := new(FlightRecorder)
+	f.mutex = new(sync.Mutex)
+	f.frames = make([]frame, n)
+	f.done = make(chan struct{})
+	f.stopped = make(chan struct{})
+
+	go f.run(interval)
+	return f
+}
+
+// take a snapshot right now, in addition to the periodic ones
+func (f *FlightRecorder) Record() {
+	buf := new(bytes.Buffer)
+	writeVars(buf, published{}, VisibilityInternal, selectPassive)
+	fr := frame{time.Now(), bytes.TrimSpace(buf.Bytes())}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.frames[f.next] = fr
+	f.next = (f.next + 1) % len(f.frames)
+	if f.next == 0 {
+		f.full = true
+	}
+}
+
+// stop taking snapshots, keeping those already taken. It is safe to
+// call Stop more than once.
+func (f *FlightRecorder) Stop() {
+	f.once.Do(func() {
+		close(f.done)
+		<-f.stopped
+	})
+}
+
+// the retained snapshots, oldest first
+func (f *FlightRecorder) snapshots() []frame {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if !f.full {
+		return append([]frame(nil), f.frames[:f.next]...)
+	}
+	return append(append([]frame(nil), f.frames[f.next:]...), f.frames[:f.next]...)
+}
+
+func (f *FlightRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "[")
+	for i, fr := range f.snapshots() {
+		if i > 0 {
+			fmt.Fprintf(w, ",")
+		}
+		fmt.Fprintf(w, "\n{\"time\": %q, \"vars\": %s}", fr.at.Format(time.RFC3339Nano), fr.vars)
+	}
+	fmt.Fprintf(w, "\n]\n")
+}
+
+func (f *FlightRecorder) run(interval time.Duration) {
+	defer close(f.stopped)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			f.Record()
+		case <-f.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package variant
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type recordedFrame struct {
+	Time time.Time
+	Vars map[string]json.RawMessage
+}
+
+func recorded(f *FlightRecorder) []recordedFrame {
+	rec := httptest.NewRecorder()
+	f.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/variant/history", nil))
+	var frames []recordedFrame
+	if err := json.Unmarshal(rec.Body.Bytes(), &frames); err != nil {
+		panic(err)
+	}
+	return frames
+}
+
+func TestFlightRecorderKeepsLatest(t *testing.T) {
+	unregisterAfter(t, "test.recorder.gauge")
+	g := NewGauge("test.recorder.gauge")
+	f := NewFlightRecorder(time.Hour, 2)
+	defer f.Stop()
+
+	if frames := recorded(f); len(frames) != 0 {
+		t.Errorf("expected no frames, got %d", len(frames))
+	}
+	for i := 1; i <= 3; i++ {
+		g.Set(float64(i))
+		f.Record()
+	}
+
+	frames := recorded(f)
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(frames))
+	}
+	if v := string(frames[0].Vars["test.recorder.gauge"]); v != "2.000000" {
+		t.Errorf("expected oldest frame to hold 2.000000, got %s", v)
+	}
+	if v := string(frames[1].Vars["test.recorder.gauge"]); v != "3.000000" {
+		t.Errorf("expected newest frame to hold 3.000000, got %s", v)
+	}
+	if frames[0].Time.After(frames[1].Time) {
+		t.Errorf("expected frames oldest first")
+	}
+}
+
+func TestFlightRecorderInterval(t *testing.T) {
+	f := NewFlightRecorder(time.Millisecond, 10)
+	deadline := time.Now().Add(time.Second)
+	for len(f.snapshots()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	f.Stop()
+	f.Stop()
+	if len(f.snapshots()) == 0 {
+		t.Errorf("expected periodic snapshots")
+	}
+}
+
+func TestFlightRecorderSkipsDeltas(t *testing.T) {
+	unregisterAfter(t, "test.recorder.delta")
+	c := NewInt("")
+	d := NewDelta("test.recorder.delta", c)
+	f := NewFlightRecorder(time.Hour, 1)
+	defer f.Stop()
+
+	c.Add(5)
+	f.Record()
+	if _, ok := recorded(f)[0].Vars["test.recorder.delta"]; ok {
+		t.Errorf("expected deltas to be left out of snapshots")
+	}
+	if v := d.Value(); v != 5 {
+		t.Errorf("expected the delta to be kept for its reader, got %d", v)
+	}
+}
+
+func TestFlightRecorderRejectsBadArguments(t *testing.T) {
+	for _, args := range []struct {
+		interval time.Duration
+		n        int
+	}{{0, 1}, {time.Second, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected NewFlightRecorder(%s, %d) to panic", args.interval, args.n)
+				}
+			}()
+			NewFlightRecorder(args.interval, args.n)
+		}()
+	}
+}
@@ -0,0 +1,188 @@
+package variant
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// A set of vars which, unlike expvar's global map, can be removed
+// again, so short lived workers and tests do not leak them.
+//
+// The package level constructors register with DefaultRegistry, whose
+// vars also appear on /debug/vars. Other registries are private: a
+// var registered with one is only served by its own Handler, which
+// makes them suit tests which would otherwise collide on names.
+// Metadata attached with Describe applies by name in every registry.
+// it is thread/goroutine safe
+type Registry struct {
+	mutex *sync.RWMutex
+	vars  map[string]expvar.Var
+	// mirror names into expvar, for DefaultRegistry
+	exported bool
+}
+
+// The registry the package level constructors publish to
+var DefaultRegistry = &Registry{mutex: new(sync.RWMutex), vars: make(map[string]expvar.Var), exported: true}
+
+// serializes publishing DefaultRegistry names into expvar
+var exportMutex = new(sync.Mutex)
+
+// Create an empty registry
+func NewRegistry() *Registry {
+	return &Registry{mutex: new(sync.RWMutex), vars: make(map[string]expvar.Var)}
+}
+
+// Add `v` to the registry under `name`. It panics if the name is empty
+// or already registered, as expvar.Publish does.
+//
+// Create stats with an empty name to register them with a registry
+// other than DefaultRegistry:
+//
+//	reg.Register("db.latency", variant.NewSimpleMovingAverage("", 100))
+func (r *Registry) Register(name string, v expvar.Var) {
+	if name == "" {
+		panic("variant: empty name for Register")
+	}
+	if r.exported {
+		r.export(name)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.vars[name]; ok {
+		panic(fmt.Sprintf("variant: reuse of registered name %q", name))
+	}
+	r.vars[name] = v
+	if r.exported {
+		self.published.Add(1)
+	}
+}
+
+// make `name` visible through expvar. expvar cannot forget a name, so
+// what it holds is a stand-in looking the var up in the registry, and
+// registering the name again after Unregister reuses it.
+func (r *Registry) export(name string) {
+	exportMutex.Lock()
+	defer exportMutex.Unlock()
+	if existing := expvar.Get(name); existing != nil {
+		if ev, ok := existing.(*exportedVar); ok && ev.registry == r {
+			return
+		}
+		panic(fmt.Sprintf("variant: reuse of registered name %q", name))
+	}
+	expvar.Publish(name, &exportedVar{r, name})
+}
+
+// Remove the var registered under `name`, reporting whether there was
+// one. For DefaultRegistry the name stays on /debug/vars, as expvar
+// cannot remove it, but with the value null.
+func (r *Registry) Unregister(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, ok := r.vars[name]
+	delete(r.vars, name)
+	if ok && r.exported {
+		self.published.Add(-1)
+	}
+	return ok
+}
+
+// Discard the accumulated values of every registered stat which can be
+// reset, keeping them registered
+func (r *Registry) Reset() {
+	r.Do(func(kv expvar.KeyValue) {
+		if rs, ok := kv.Value.(resetter); ok {
+			rs.Reset()
+		}
+	})
+}
+
+// obtain the var registered under `name`, or nil
+func (r *Registry) Get(name string) expvar.Var {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.vars[name]
+}
+
+// Call `fn` for every registered var, in name order. The registry is
+// not locked while `fn` runs, so it may register and unregister.
+func (r *Registry) Do(fn func(kv expvar.KeyValue)) {
+	r.mutex.RLock()
+	kvs := make([]expvar.KeyValue, 0, len(r.vars))
+	for name, v := range r.vars {
+		kvs = append(kvs, expvar.KeyValue{Key: name, Value: v})
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	for _, kv := range kvs {
+		fn(kv)
+	}
+}
+
+// Create a handler serving the registered vars, like Handler does for
+// every published var: in the same JSON shape as /debug/vars,
+// restricted to those at least as visible as `level`, and taking the
+// same query parameters.
+func (r *Registry) Handler(level Visibility) http.Handler {
+	return varsHandler(r, level)
+}
+
+// the stand-in expvar holds for a DefaultRegistry var
+type exportedVar struct {
+	registry *Registry
+	name     string
+}
+
+func (e *exportedVar) String() string {
+	if v := e.registry.Get(e.name); v != nil {
+		return v.String()
+	}
+	return "null"
+}
+
+// a set of vars handlers can serve
+type varSet interface {
+	Do(fn func(kv expvar.KeyValue))
+	Get(name string) expvar.Var
+}
+
+// every var published with expvar, including DefaultRegistry's
+type published struct{}
+
+func (published) Do(fn func(kv expvar.KeyValue)) {
+	Do(fn)
+}
+
+func (published) Get(name string) expvar.Var {
+	return Get(name)
+}
+
+// Call `fn` for every var published with expvar, in name order, as
+// expvar.Do does, but seeing the vars registered with DefaultRegistry
+// themselves rather than the stand-ins expvar holds for them, and
+// skipping those which have been unregistered
+func Do(fn func(kv expvar.KeyValue)) {
+	expvar.Do(func(kv expvar.KeyValue) {
+		if ev, ok := kv.Value.(*exportedVar); ok {
+			if kv.Value = ev.registry.Get(ev.name); kv.Value == nil {
+				return
+			}
+		}
+		fn(kv)
+	})
+}
+
+// obtain the var published under `name`, as expvar.Get does, but
+// seeing through to vars registered with DefaultRegistry. It returns
+// nil for names which have been unregistered.
+func Get(name string) expvar.Var {
+	v := expvar.Get(name)
+	if ev, ok := v.(*exportedVar); ok {
+		return ev.registry.Get(ev.name)
+	}
+	return v
+}
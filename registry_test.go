@@ -0,0 +1,97 @@
+package variant
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistryHandler(t *testing.T) {
+	reg := NewRegistry()
+	s := NewSimpleMovingAverage("", 3)
+	s.Update(2)
+	reg.Register("test.registry.avg", s)
+	reg.Register("test.registry.count", NewInt(""))
+
+	rec := httptest.NewRecorder()
+	reg.Handler(VisibilityInternal).ServeHTTP(rec, httptest.NewRequest("GET", "/vars", nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", rec.Body.String(), err)
+	}
+	if len(body) != 2 || body["test.registry.avg"] != 2.0 {
+		t.Errorf("expected only the registered vars, got %v", body)
+	}
+	if expvar.Get("test.registry.avg") != nil {
+		t.Errorf("expected a private registry to stay off /debug/vars")
+	}
+}
+
+func TestRegistryUnregisterAndReset(t *testing.T) {
+	reg := NewRegistry()
+	s := NewSimpleMovingAverage("", 3)
+	s.Update(1)
+	reg.Register("a", s)
+
+	reg.Reset()
+	if vals := s.Values(); len(vals) != 0 {
+		t.Errorf("expected Reset to empty the window, got %v", vals)
+	}
+	if !reg.Unregister("a") || reg.Get("a") != nil {
+		t.Errorf("expected the var to be removed")
+	}
+	if reg.Unregister("a") {
+		t.Errorf("expected a second Unregister to find nothing")
+	}
+	reg.Register("a", NewGauge(""))
+}
+
+func TestRegistryRejectsReuse(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("a", NewGauge(""))
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic registering a name twice")
+		}
+	}()
+	reg.Register("a", NewGauge(""))
+}
+
+// unregister `names` from DefaultRegistry once the test ends, so tests
+// publishing fixed names can run more than once
+func unregisterAfter(t *testing.T, names ...string) {
+	t.Cleanup(func() {
+		for _, name := range names {
+			DefaultRegistry.Unregister(name)
+		}
+	})
+}
+
+func TestDefaultRegistryUnregister(t *testing.T) {
+	unregisterAfter(t, "test.registry.default")
+	g := NewGauge("test.registry.default")
+	g.Set(3)
+	if Get("test.registry.default") != g {
+		t.Errorf("expected Get to see the gauge itself")
+	}
+	if s := expvar.Get("test.registry.default").String(); s != "3.000000" {
+		t.Errorf("expected /debug/vars to show 3.000000, got %s", s)
+	}
+
+	DefaultRegistry.Unregister("test.registry.default")
+	if s := expvar.Get("test.registry.default").String(); s != "null" {
+		t.Errorf("expected an unregistered name to show null, got %s", s)
+	}
+	Do(func(kv expvar.KeyValue) {
+		if kv.Key == "test.registry.default" {
+			t.Errorf("expected Do to skip the unregistered name")
+		}
+	})
+
+	// the name can be used again
+	NewGauge("test.registry.default").Set(4)
+	if s := expvar.Get("test.registry.default").String(); s != "4.000000" {
+		t.Errorf("expected the new gauge, got %s", s)
+	}
+}
@@ -0,0 +1,219 @@
+package variant
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The wire format a Reporter pushes in
+type ReporterProtocol int
+
+const (
+	// StatsD gauges, "name:value|g", in UDP datagrams. Negative values
+	// are sent as "name:0|g" followed by the value, as a signed gauge
+	// alone would adjust the current value rather than set it.
+	StatsD ReporterProtocol = iota
+	// the Graphite plaintext protocol, "name value timestamp", over TCP
+	Graphite
+)
+
+// the largest StatsD datagram a Reporter sends, small enough to pass
+// an Ethernet MTU unfragmented
+const statsdPacketSize = 1432
+
+// configures a Reporter
+type ReporterOption func(*Reporter)
+
+// Push in `protocol` rather than StatsD
+func WithProtocol(protocol ReporterProtocol) ReporterOption {
+	return func(r *Reporter) { r.protocol = protocol }
+}
+
+// Prefix every metric name with `prefix` and a dot, e.g. a host name
+func WithPrefix(prefix string) ReporterOption {
+	return func(r *Reporter) { r.prefix = prefix }
+}
+
+// Push only stats at least as visible as `level`, rather than every
+// stat
+func WithVisibility(level Visibility) ReporterOption {
+	return func(r *Reporter) { r.level = level }
+}
+
+// Call `fn` with every error a background flush hits, which are
+// otherwise dropped
+func WithErrorHandler(fn func(error)) ReporterOption {
+	return func(r *Reporter) { r.onError = fn }
+}
+
+// Reporter periodically pushes every published stat to a StatsD or
+// Graphite endpoint, for deployments where nothing can scrape
+// /debug/vars.
+//
+// Each var with a numeric value is sent under its name, and each
+// numeric field of a var whose value is a JSON object, such as a
+// MovingSummary, under its name, a dot and the field name, nesting as
+// deep as the object does. Every metric is sent as a gauge, and vars
+// which reset when read, such as Delta, are left out so the reporter
+// does not steal their values.
+type Reporter struct {
+	addr     string
+	interval time.Duration
+	protocol ReporterProtocol
+	prefix   string
+	level    Visibility
+	onError  func(error)
+	now      func() time.Time
+}
+
+// Create a reporter pushing to `addr`, a host:port, every `interval`.
+// It pushes nothing until started.
+func NewReporter(addr string, interval time.Duration, opts ...ReporterOption) *Reporter {
+	if interval <= 0 {
+		panic("variant: non-positive interval for NewReporter")
+	}
+	r := &Reporter{addr: addr, interval: interval, now: time.Now}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Push every interval in a background goroutine until `ctx` is done,
+// returning the reporter so creating and starting chain
+func (r *Reporter) Start(ctx context.Context) *Reporter {
+	go func() {
+		tick := time.NewTicker(r.interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				if err := r.Flush(); err != nil && r.onError != nil {
+					r.onError(err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// Push every stat once, now
+func (r *Reporter) Flush() error {
+	points := r.collect()
+	if len(points) == 0 {
+		return nil
+	}
+
+	network := "udp"
+	if r.protocol == Graphite {
+		network = "tcp"
+	}
+	conn, err := net.Dial(network, r.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if r.protocol == Graphite {
+		var buf bytes.Buffer
+		ts := r.now().Unix()
+		for _, p := range points {
+			fmt.Fprintf(&buf, "%s %s %d\n", p.name, p.value, ts)
+		}
+		_, err = conn.Write(buf.Bytes())
+		return err
+	}
+
+	var packet []byte
+	for _, p := range points {
+		line := p.name + ":" + p.value + "|g\n"
+		if strings.HasPrefix(p.value, "-") {
+			// StatsD reads a signed gauge as a change to the
+			// current value, so zero it first to set it; both lines
+			// go in one datagram so they arrive together and in order
+			line = p.name + ":0|g\n" + line
+		}
+		if len(packet) > 0 && len(packet)+len(line) > statsdPacketSize {
+			if _, err := conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		packet = append(packet, line...)
+	}
+	_, err = conn.Write(packet)
+	return err
+}
+
+// a number to push and the name to push it under
+type reportPoint struct {
+	name  string
+	value string
+}
+
+// every number the published stats hold, by name
+func (r *Reporter) collect() []reportPoint {
+	var points []reportPoint
+	Do(func(kv expvar.KeyValue) {
+		if _, ok := kv.Value.(readResetter); ok {
+			return
+		}
+		value, ok := render(kv, r.level)
+		if !ok {
+			return
+		}
+		name := kv.Key
+		if r.prefix != "" {
+			name = r.prefix + "." + name
+		}
+
+		dec := json.NewDecoder(strings.NewReader(value))
+		dec.UseNumber()
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return
+		}
+		points = flatten(points, reportName(name), doc)
+	})
+	return points
+}
+
+// append the numbers in `doc` to `points`, naming the fields of
+// objects after their path from `name`
+func flatten(points []reportPoint, name string, doc interface{}) []reportPoint {
+	switch node := doc.(type) {
+	case json.Number:
+		points = append(points, reportPoint{name, node.String()})
+	case map[string]interface{}:
+		keys := make([]string, 0, len(node))
+		for key := range node {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			points = flatten(points, name+"."+reportName(key), node[key])
+		}
+	}
+	return points
+}
+
+// a name with the characters StatsD and Graphite use as separators
+// replaced by underscores
+func reportName(name string) string {
+	return strings.Map(func(c rune) rune {
+		switch c {
+		case ' ', '\t', '\n', ':', '|', '@', '/':
+			return '_'
+		}
+		return c
+	}, name)
+}
@@ -0,0 +1,106 @@
+package variant
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReporterStatsD(t *testing.T) {
+	unregisterAfter(t, "test.report.gauge", "test.report.negative", "test.report.summary", "test.report.delta")
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	NewGauge("test.report.gauge").Set(2.5)
+	NewGauge("test.report.negative").Set(-3)
+	NewMovingSummary("test.report.summary", 3, 0.5).Update(4)
+	NewDelta("test.report.delta", NewInt(""))
+
+	r := NewReporter(conn.LocalAddr().String(), time.Minute, WithPrefix("web1"))
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	buf := make([]byte, statsdPacketSize)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if n > statsdPacketSize {
+			t.Errorf("packet of %d bytes is over the limit", n)
+		}
+		lines = append(lines, strings.Split(strings.TrimSpace(string(buf[:n])), "\n")...)
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	}
+	got := strings.Join(lines, "\n") + "\n"
+	for _, want := range []string{
+		"web1.test.report.gauge:2.500000|g\n",
+		"web1.test.report.negative:0|g\nweb1.test.report.negative:-3.000000|g\n",
+		"web1.test.report.summary.count:1|g\n",
+		"web1.test.report.summary.p50:4.000000|g\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "test.report.delta") {
+		t.Errorf("expected the delta to be left out of\n%s", got)
+	}
+}
+
+func TestReporterGraphite(t *testing.T) {
+	unregisterAfter(t, "test.report.count")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var b strings.Builder
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			b.WriteString(sc.Text() + "\n")
+		}
+		received <- b.String()
+	}()
+
+	NewInt("test.report.count").Add(7)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewReporter(ln.Addr().String(), 10*time.Millisecond, WithProtocol(Graphite))
+	r.now = func() time.Time { return time.Unix(1234, 0) }
+	r.Start(ctx)
+
+	select {
+	case got := <-received:
+		if !strings.Contains(got, "test.report.count 7 1234\n") {
+			t.Errorf("expected the counter in\n%s", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("nothing was pushed")
+	}
+}
+
+func TestReporterRejectsBadInterval(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected NewReporter to panic on a zero interval")
+		}
+	}()
+	NewReporter("127.0.0.1:8125", 0)
+}
@@ -0,0 +1,239 @@
+package variant
+
+import (
+	"container/heap"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// the longest a decaying reservoir goes between moving its landmark
+// forward
+const reservoirRescale = time.Hour
+
+// the largest exponent a decaying reservoir lets a weight reach before
+// moving its landmark forward. exp(50) is about 5e21, so even divided
+// by the smallest random draw a priority stays far from overflowing.
+const reservoirMaxExponent = 50
+
+// represents a percentile of a random sample of the values seen, held
+// in a fixed size reservoir. Without decay every value ever seen is
+// equally likely to be in the sample (Vitter's Algorithm R); with
+// decay recent values are exponentially more likely to be and weigh
+// more when they are (forward decay, Cormode et al.), so the
+// percentile follows the recent past however bursty the updates.
+// it is thread/goroutine safe
+type ReservoirPercentile struct {
+	mutex      *sync.Mutex
+	size       int
+	percentile float64
+	alpha      float64
+	seen       int64
+	samples    reservoirHeap
+	landmark   time.Time
+	rng        *rand.Rand
+	now        func() time.Time
+}
+
+// a value in a reservoir with its forward decay weight and priority
+type reservoirSample struct {
+	value    float64
+	weight   float64
+	priority float64
+}
+
+// a min-heap on priority, so the sample to evict is always first
+type reservoirHeap []reservoirSample
+
+func (h reservoirHeap) Len() int            { return len(h) }
+func (h reservoirHeap) Less(i, j int) bool  { return h[i].priority < h[j].priority }
+func (h reservoirHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *reservoirHeap) Push(x interface{}) { *h = append(*h, x.(reservoirSample)) }
+func (h *reservoirHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Create a new reservoir percentile expvar.Var. It will be published
+// under `name` and report the percentile of a uniform random sample
+// of `reservoirSize` of every value seen.
+//
+// percentile must be between 0 and 1
+//
+// An empty name will cause it to not be published.
+func NewReservoirPercentile(name string, percentile float64, reservoirSize int) *ReservoirPercentile {
+	r := newReservoirPercentile(percentile, reservoirSize, 0)
+	publish(name, r)
+	return r
+}
+
+// Create a new decaying percentile expvar.Var. It will be published
+// under `name` and report the percentile of a sample of
+// `reservoirSize` values biased towards recent ones: a value's weight
+// falls by a factor of e every 1/`alpha` seconds, so 0.015 makes the
+// last five minutes or so dominate.
+//
+// percentile must be between 0 and 1, and alpha positive
+//
+// An empty name will cause it to not be published.
+func NewDecayingPercentile(name string, percentile float64, reservoirSize int, alpha float64) *ReservoirPercentile {
+	if !(alpha > 0) {
+		panic("variant: non-positive alpha for NewDecayingPercentile")
+	}
+	r := newReservoirPercentile(percentile, reservoirSize, alpha)
+	publish(name, r)
+	return r
+}
+
+func newReservoirPercentile(percentile float64, size int, alpha float64) *ReservoirPercentile {
+	r := new(ReservoirPercentile)
+	r.mutex = new(sync.Mutex)
+	r.size = size
+	r.percentile = percentile
+	r.alpha = alpha
+	r.samples = make(reservoirHeap, 0, size)
+	r.rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	r.now = time.Now
+	r.landmark = r.now()
+	return r
+}
+
+// display the value as a string
+func (r *ReservoirPercentile) String() string {
+	return formatFloat(r.Value())
+}
+
+// Offer a new value to the reservoir
+func (r *ReservoirPercentile) Update(val float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.offer(val)
+}
+
+// Offer several values to the reservoir, taking the lock once
+func (r *ReservoirPercentile) UpdateBatch(vals []float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, val := range vals {
+		r.offer(val)
+	}
+}
+
+// keep or drop a value. Must be called with the mutex held.
+func (r *ReservoirPercentile) offer(val float64) {
+	r.seen++
+	if r.alpha == 0 {
+		// Algorithm R: the n-th value replaces a random sample with
+		// probability size/n
+		if len(r.samples) < r.size {
+			r.samples = append(r.samples, reservoirSample{value: val, weight: 1})
+		} else if j := r.rng.Int64N(r.seen); j < int64(r.size) {
+			r.samples[j].value = val
+		}
+		return
+	}
+
+	now := r.now()
+	if elapsed := now.Sub(r.landmark); elapsed >= reservoirRescale || r.alpha*elapsed.Seconds() >= reservoirMaxExponent {
+		r.rescale(now)
+	}
+	weight := math.Exp(r.alpha * now.Sub(r.landmark).Seconds())
+	// 1 - Float64 is in (0, 1], so the priority is finite
+	sample := reservoirSample{val, weight, weight / (1 - r.rng.Float64())}
+	if len(r.samples) < r.size {
+		heap.Push(&r.samples, sample)
+	} else if r.size > 0 && sample.priority > r.samples[0].priority {
+		r.samples[0] = sample
+		heap.Fix(&r.samples, 0)
+	}
+}
+
+// move the landmark to `now`, scaling every weight and priority down
+// to match. Scaling them all by one factor keeps the heap ordered;
+// samples old enough to underflow to zero are the first evicted.
+// Must be called with the mutex held.
+func (r *ReservoirPercentile) rescale(now time.Time) {
+	factor := math.Exp(-r.alpha * now.Sub(r.landmark).Seconds())
+	for i := range r.samples {
+		r.samples[i].weight *= factor
+		r.samples[i].priority *= factor
+	}
+	r.landmark = now
+}
+
+// Discard every sample
+func (r *ReservoirPercentile) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.samples = r.samples[:0]
+	r.seen = 0
+	r.landmark = r.now()
+}
+
+// Change the percentile reported, keeping the samples.
+//
+// percentile must be between 0 and 1, otherwise SetPercentile panics
+func (r *ReservoirPercentile) SetPercentile(percentile float64) {
+	if !(percentile >= 0 && percentile <= 1) {
+		panic("variant: percentile must be between 0 and 1")
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.percentile = percentile
+}
+
+// obtain the percentile reported, which a reservoir always has
+func (r *ReservoirPercentile) ReportedPercentile() (float64, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.percentile, true
+}
+
+// obtain the current value: the weighted percentile of the samples,
+// which with equal weights is the one percentileOf would give, or 0
+// when there are none
+func (r *ReservoirPercentile) Value() float64 {
+	r.mutex.Lock()
+	samples := append([]reservoirSample(nil), r.samples...)
+	percentile := r.percentile
+	r.mutex.Unlock()
+	return weightedPercentile(samples, percentile)
+}
+
+// the weighted `percentile` of `samples`, which are sorted in place
+func weightedPercentile(samples []reservoirSample, percentile float64) float64 {
+	if len(samples) == 0 {
+		return 0.0
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return floatLess(samples[i].value, samples[j].value)
+	})
+	total := 0.0
+	for _, s := range samples {
+		total += s.weight
+	}
+	target := total * percentile
+	cum := 0.0
+	for _, s := range samples {
+		cum += s.weight
+		if cum > target {
+			return s.value
+		}
+	}
+	return samples[len(samples)-1].value
+}
+
+// obtain a copy of the values in the reservoir, in no particular order
+func (r *ReservoirPercentile) Values() []float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	values := make([]float64, len(r.samples))
+	for i, s := range r.samples {
+		values[i] = s.value
+	}
+	return values
+}
@@ -0,0 +1,111 @@
+package variant
+
+import (
+	"expvar"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func newTestReservoir(r *ReservoirPercentile) (*ReservoirPercentile, *fakeClock) {
+	clock := &fakeClock{time.Unix(1000, 0)}
+	r.now = clock.now
+	r.rng = rand.New(rand.NewPCG(1, 2))
+	r.Reset()
+	return r, clock
+}
+
+func TestReservoirAsVar(t *testing.T) {
+	var _ expvar.Var = NewReservoirPercentile("", 0.5, 10)
+}
+
+func TestReservoirExactWhenNotFull(t *testing.T) {
+	for _, r := range []*ReservoirPercentile{
+		NewReservoirPercentile("", 0.9, 100),
+		NewDecayingPercentile("", 0.9, 100, 0.015),
+	} {
+		for i := 1; i <= 10; i++ {
+			r.Update(float64(i))
+		}
+		if v := r.Value(); v != 10.0 {
+			t.Errorf("expected p90 of 10.0, got %f", v)
+		}
+	}
+}
+
+func TestReservoirUniformSample(t *testing.T) {
+	r, _ := newTestReservoir(NewReservoirPercentile("", 0.5, 100))
+	for i := 0; i < 10000; i++ {
+		r.Update(float64(i))
+	}
+	if n := len(r.Values()); n != 100 {
+		t.Errorf("expected the reservoir to hold 100 samples, got %d", n)
+	}
+	if v := r.Value(); v < 3000 || v > 7000 {
+		t.Errorf("expected a median near 5000, got %f", v)
+	}
+}
+
+func TestDecayingFavoursRecent(t *testing.T) {
+	r, clock := newTestReservoir(NewDecayingPercentile("", 0.5, 100, 0.015))
+	for i := 0; i < 1000; i++ {
+		r.Update(100)
+	}
+	clock.advance(10 * time.Minute)
+	for i := 0; i < 1000; i++ {
+		r.Update(1)
+	}
+	if v := r.Value(); v != 1.0 {
+		t.Errorf("expected recent values to dominate, got %f", v)
+	}
+}
+
+func TestDecayingRescales(t *testing.T) {
+	r, clock := newTestReservoir(NewDecayingPercentile("", 0.5, 10, 0.1))
+	for i := 0; i < 24; i++ {
+		clock.advance(time.Hour)
+		r.Update(float64(i))
+	}
+	for _, s := range r.samples {
+		if math.IsInf(s.weight, 0) || math.IsInf(s.priority, 0) || math.IsNaN(s.priority) {
+			t.Fatalf("expected finite weights after rescaling, got %+v", s)
+		}
+	}
+	if v := r.Value(); v != 23.0 {
+		t.Errorf("expected the newest value to dominate, got %f", v)
+	}
+}
+
+func TestDecayingLargeAlpha(t *testing.T) {
+	r, clock := newTestReservoir(NewDecayingPercentile("", 0.5, 100, 1000))
+	clock.advance(800 * time.Millisecond)
+	for i := 1; i <= 100; i++ {
+		clock.advance(time.Microsecond)
+		r.Update(float64(i))
+	}
+	for _, s := range r.samples {
+		if math.IsInf(s.weight, 0) || math.IsInf(s.priority, 0) || math.IsNaN(s.priority) {
+			t.Fatalf("expected finite weights, got %+v", s)
+		}
+	}
+	if v := r.Value(); v < 45 || v > 55 {
+		t.Errorf("expected a median near 50, got %f", v)
+	}
+
+	// an idle spell far beyond the window leaves only new values
+	clock.advance(time.Hour)
+	r.Update(7)
+	if v := r.Value(); v != 7.0 {
+		t.Errorf("expected the one fresh value to dominate, got %f", v)
+	}
+}
+
+func TestDecayingRejectsBadAlpha(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected NewDecayingPercentile to panic on a zero alpha")
+		}
+	}()
+	NewDecayingPercentile("", 0.5, 10, 0)
+}
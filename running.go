@@ -0,0 +1,232 @@
+package variant
+
+import "math"
+
+// a sum maintained as values enter and leave a window, so the mean is
+// O(1) to read. Non-finite values are counted rather than summed, so
+// one NaN or Inf passing through does not poison the sum after it has
+// left the window.
+type runningSum struct {
+	sum    float64
+	n      int
+	nan    int
+	posInf int
+	negInf int
+}
+
+// account for `val` entering the window
+func (r *runningSum) add(val float64) {
+	r.n++
+	switch {
+	case math.IsNaN(val):
+		r.nan++
+	case math.IsInf(val, 1):
+		r.posInf++
+	case math.IsInf(val, -1):
+		r.negInf++
+	default:
+		r.sum += val
+	}
+}
+
+// account for `val` leaving the window
+func (r *runningSum) remove(val float64) {
+	r.n--
+	switch {
+	case math.IsNaN(val):
+		r.nan--
+	case math.IsInf(val, 1):
+		r.posInf--
+	case math.IsInf(val, -1):
+		r.negInf--
+	default:
+		r.sum -= val
+	}
+}
+
+// the mean of the window, NaN when it is empty, as mean would give
+func (r *runningSum) mean() float64 {
+	switch {
+	case r.n == 0, r.nan > 0, r.posInf > 0 && r.negInf > 0:
+		return math.NaN()
+	case r.posInf > 0:
+		return math.Inf(1)
+	case r.negInf > 0:
+		return math.Inf(-1)
+	}
+	return r.sum / float64(r.n)
+}
+
+// an order statistic tree: a treap whose nodes know the size of their
+// subtree, so inserting, removing and finding the k-th smallest value
+// are all O(log n). Nodes live in one slice and are recycled through a
+// free list, so a full window updates without allocating.
+//
+// Values are ordered as sort.Float64s orders them, with NaN first.
+type orderTree struct {
+	nodes []treeNode
+	free  []int32
+	root  int32
+	seed  uint64
+}
+
+type treeNode struct {
+	value       float64
+	priority    uint32
+	size        int32
+	left, right int32
+}
+
+// the index standing in for a missing child
+const noNode = -1
+
+func newOrderTree(capacity int) *orderTree {
+	return &orderTree{
+		nodes: make([]treeNode, 0, capacity),
+		root:  noNode,
+		seed:  0x9e3779b97f4a7c15,
+	}
+}
+
+// the number of values in the tree
+func (t *orderTree) len() int {
+	return int(t.size(t.root))
+}
+
+// discard every value, keeping the storage
+func (t *orderTree) reset() {
+	t.nodes = t.nodes[:0]
+	t.free = t.free[:0]
+	t.root = noNode
+}
+
+// add a value
+func (t *orderTree) insert(val float64) {
+	l, r := t.split(t.root, val, false)
+	t.root = t.merge(t.merge(l, t.alloc(val)), r)
+}
+
+// remove one occurrence of a value, if there is one
+func (t *orderTree) remove(val float64) {
+	l, r := t.split(t.root, val, false)
+	m, r := t.split(r, val, true)
+	if m != noNode {
+		drop := m
+		m = t.merge(t.nodes[m].left, t.nodes[m].right)
+		t.free = append(t.free, drop)
+	}
+	t.root = t.merge(t.merge(l, m), r)
+}
+
+// the `percentile` of the values, using the same index percentileOf
+// does, or 0 when there are none
+func (t *orderTree) percentile(percentile float64) float64 {
+	n := t.len()
+	if n == 0 {
+		return 0.0
+	}
+	k := int(float64(n) * percentile)
+	if k >= n {
+		k = n - 1
+	}
+	return t.nth(k)
+}
+
+// the k-th smallest value, counting from 0
+func (t *orderTree) nth(k int) float64 {
+	at := t.root
+	for {
+		node := &t.nodes[at]
+		left := int(t.size(node.left))
+		switch {
+		case k < left:
+			at = node.left
+		case k == left:
+			return node.value
+		default:
+			k -= left + 1
+			at = node.right
+		}
+	}
+}
+
+// a node holding `val`, reusing a freed one when possible
+func (t *orderTree) alloc(val float64) int32 {
+	// xorshift is plenty for treap priorities and keeps the tree
+	// deterministic
+	t.seed ^= t.seed << 13
+	t.seed ^= t.seed >> 7
+	t.seed ^= t.seed << 17
+	node := treeNode{value: val, priority: uint32(t.seed), size: 1, left: noNode, right: noNode}
+
+	if n := len(t.free); n > 0 {
+		at := t.free[n-1]
+		t.free = t.free[:n-1]
+		t.nodes[at] = node
+		return at
+	}
+	t.nodes = append(t.nodes, node)
+	return int32(len(t.nodes) - 1)
+}
+
+func (t *orderTree) size(at int32) int32 {
+	if at == noNode {
+		return 0
+	}
+	return t.nodes[at].size
+}
+
+// recompute the size of a node from its children
+func (t *orderTree) fix(at int32) {
+	node := &t.nodes[at]
+	node.size = 1 + t.size(node.left) + t.size(node.right)
+}
+
+// split the subtree at `at` into the values ordered before `val`, or
+// also those equal to it when `orEqual` is set, and the rest
+func (t *orderTree) split(at int32, val float64, orEqual bool) (int32, int32) {
+	if at == noNode {
+		return noNode, noNode
+	}
+	node := &t.nodes[at]
+	var before bool
+	if orEqual {
+		before = !floatLess(val, node.value)
+	} else {
+		before = floatLess(node.value, val)
+	}
+	if before {
+		l, r := t.split(node.right, val, orEqual)
+		t.nodes[at].right = l
+		t.fix(at)
+		return at, r
+	}
+	l, r := t.split(node.left, val, orEqual)
+	t.nodes[at].left = r
+	t.fix(at)
+	return l, at
+}
+
+// join two subtrees where every value in `a` is ordered before every
+// value in `b`
+func (t *orderTree) merge(a, b int32) int32 {
+	if a == noNode {
+		return b
+	}
+	if b == noNode {
+		return a
+	}
+	if t.nodes[a].priority > t.nodes[b].priority {
+		t.nodes[a].right = t.merge(t.nodes[a].right, b)
+		t.fix(a)
+		return a
+	}
+	t.nodes[b].left = t.merge(a, t.nodes[b].left)
+	t.fix(b)
+	return b
+}
+
+// the ordering sort.Float64s uses, which puts NaN before everything
+func floatLess(a, b float64) bool {
+	return a < b || (math.IsNaN(a) && !math.IsNaN(b))
+}
@@ -0,0 +1,77 @@
+package variant
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+	"testing"
+)
+
+func TestOrderTreeMatchesSort(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	tree := newOrderTree(64)
+	var window []float64
+	for i := 0; i < 2000; i++ {
+		val := float64(rng.IntN(50))
+		if len(window) == 64 {
+			tree.remove(window[0])
+			window = window[1:]
+		}
+		tree.insert(val)
+		window = append(window, val)
+
+		sorted := append([]float64(nil), window...)
+		sort.Float64s(sorted)
+		for _, p := range []float64{0, 0.5, 0.99, 1} {
+			if got, want := tree.percentile(p), percentileOfSorted(sorted, p); got != want {
+				t.Fatalf("step %d: p%v is %f, expected %f", i, p, got, want)
+			}
+		}
+	}
+	if n := len(tree.nodes); n > 64 {
+		t.Errorf("expected freed nodes to be reused, tree grew to %d", n)
+	}
+}
+
+func TestOrderTreeNaN(t *testing.T) {
+	tree := newOrderTree(3)
+	tree.insert(2)
+	tree.insert(math.NaN())
+	tree.insert(1)
+	if v := tree.nth(0); !math.IsNaN(v) {
+		t.Errorf("expected NaN to sort first, got %f", v)
+	}
+	tree.remove(math.NaN())
+	if n, v := tree.len(), tree.nth(0); n != 2 || v != 1 {
+		t.Errorf("expected [1 2] after removing NaN, got %d values starting %f", n, v)
+	}
+}
+
+func TestRunningSumRecoversFromNonFinite(t *testing.T) {
+	s := NewSimpleMovingAverage("", 2)
+	s.Update(math.Inf(1))
+	s.Update(math.Inf(-1))
+	if avg := s.Value(); !math.IsNaN(avg) {
+		t.Errorf("expected NaN with both infinities, got %f", avg)
+	}
+	s.Update(1)
+	if avg := s.Value(); !math.IsInf(avg, -1) {
+		t.Errorf("expected -Inf, got %f", avg)
+	}
+	s.Update(3)
+	if avg := s.Value(); avg != 2.0 {
+		t.Errorf("expected avg of 2.0 once the infinities left, got %f", avg)
+	}
+}
+
+func TestPercentileAfterResize(t *testing.T) {
+	s := NewSimpleMovingPercentile("", 0.5, 5)
+	s.UpdateBatch([]float64{5, 4, 3, 2, 1})
+	s.Resize(2)
+	if v := s.Value(); v != 2.0 {
+		t.Errorf("expected median of [2 1] to be 2.0, got %f", v)
+	}
+	if problems := s.Audit(); len(problems) != 0 {
+		t.Errorf("unexpected findings %v", problems)
+	}
+}
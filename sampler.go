@@ -0,0 +1,97 @@
+package variant
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Implemented by stats which accept new values
+type Updater interface {
+	Update(val float64)
+}
+
+// Sampler periodically reads a value from somewhere else and feeds it
+// into a stat, maintaining a moving aggregate of a variable which does
+// not know about this package.
+type Sampler struct {
+	fn      func() float64
+	dst     Updater
+	paused  atomic.Bool
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Create a new Sampler which calls `fn` every `interval` and feeds
+// the result into `dst`. Call Stop when done with it to release the
+// background goroutine.
+//
+// Like time.NewTicker, it panics if `interval` is not positive.
+func NewSampler(fn func() float64, dst Updater, interval time.Duration) *Sampler {
+	if interval <= 0 {
+		panic("variant: non-positive interval for NewSampler")
+	}
+	s := new(Sampler)
+	s.fn = fn
+	s.dst = dst
+	s.done = make(chan struct{})
+	s.stopped = make(chan struct{})
+
+	go s.run(interval)
+	return s
+}
+
+// Sample an existing expvar.Float into `dst` every `interval`, for
+// example to keep a moving average of a value already published by
+// other code without touching its call sites.
+func Wrap(src *expvar.Float, dst Updater, interval time.Duration) *Sampler {
+	return NewSampler(src.Value, dst, interval)
+}
+
+// Sample an existing expvar.Int into `dst` every `interval`
+func WrapInt(src *expvar.Int, dst Updater, interval time.Duration) *Sampler {
+	return NewSampler(func() float64 {
+		return float64(src.Value())
+	}, dst, interval)
+}
+
+// take a sample right now, in addition to the periodic ones
+func (s *Sampler) Sample() {
+	s.dst.Update(s.fn())
+}
+
+// Suspend the periodic samples until Resume is called
+func (s *Sampler) Pause() {
+	s.paused.Store(true)
+}
+
+// Resume periodic samples after a Pause
+func (s *Sampler) Resume() {
+	s.paused.Store(false)
+}
+
+// stop sampling. It is safe to call Stop more than once.
+func (s *Sampler) Stop() {
+	s.once.Do(func() {
+		close(s.done)
+		<-s.stopped
+	})
+}
+
+func (s *Sampler) run(interval time.Duration) {
+	defer close(s.stopped)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if !s.paused.Load() {
+				s.Sample()
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
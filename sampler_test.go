@@ -0,0 +1,60 @@
+package variant
+
+import (
+	"expvar"
+	"testing"
+	"time"
+)
+
+func TestWrapFloat(t *testing.T) {
+	src := new(expvar.Float)
+	sma := NewSimpleMovingAverage("", 2)
+	s := Wrap(src, sma, time.Hour)
+	defer s.Stop()
+
+	src.Set(1)
+	s.Sample()
+	src.Set(3)
+	s.Sample()
+	if avg := sma.Value(); avg != 2.0 {
+		t.Errorf("expected avg of 2.0, got %f", avg)
+	}
+}
+
+func TestWrapInt(t *testing.T) {
+	src := new(expvar.Int)
+	sma := NewSimpleMovingAverage("", 2)
+	s := WrapInt(src, sma, time.Hour)
+	defer s.Stop()
+
+	src.Set(4)
+	s.Sample()
+	if avg := sma.Value(); avg != 4.0 {
+		t.Errorf("expected avg of 4.0, got %f", avg)
+	}
+}
+
+func TestSamplerInterval(t *testing.T) {
+	sma := NewSimpleMovingAverage("", 10)
+	s := NewSampler(func() float64 { return 5 }, sma, time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for len(sma.Values()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	s.Stop()
+	s.Stop()
+
+	if avg := sma.Value(); avg != 5.0 {
+		t.Errorf("expected avg of 5.0, got %f", avg)
+	}
+}
+
+func TestSamplerRejectsBadInterval(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected NewSampler to panic on a negative interval")
+		}
+	}()
+	NewSampler(func() float64 { return 0 }, NewSimpleMovingAverage("", 1), -time.Second)
+}
@@ -0,0 +1,143 @@
+package variant
+
+import (
+	"expvar"
+	"net/http"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// Measurements of this package's own overhead, as returned by
+// ReadSelfMetrics. Times are cumulative nanoseconds.
+type SelfMetrics struct {
+	// calls to Update or UpdateBatch on window backed stats
+	Updates int64 `json:"updates"`
+	// time spent in those calls, including waiting for the lock
+	UpdateNanos int64 `json:"update_ns"`
+	// the part of UpdateNanos spent waiting for the lock
+	LockWaitNanos int64 `json:"lock_wait_ns"`
+	// calls to Value on window backed stats
+	Values int64 `json:"values"`
+	// time spent computing those values
+	ValueNanos int64 `json:"value_ns"`
+	// requests served by handlers wrapped with MeasureScrapes
+	Scrapes int64 `json:"scrapes"`
+	// heap objects allocated while serving those requests
+	ScrapeAllocs int64 `json:"scrape_allocs"`
+	// stats currently registered with DefaultRegistry
+	Published int64 `json:"published"`
+}
+
+var self struct {
+	enabled       atomic.Bool
+	updates       atomic.Int64
+	updateNanos   atomic.Int64
+	lockWaitNanos atomic.Int64
+	values        atomic.Int64
+	valueNanos    atomic.Int64
+	scrapes       atomic.Int64
+	scrapeAllocs  atomic.Int64
+	published     atomic.Int64
+}
+
+// Start measuring the overhead of the package itself: time spent in
+// Update and waiting for locks, time spent computing values, and,
+// for handlers wrapped with MeasureScrapes, allocations per scrape.
+// Measuring costs a few clock reads per call, so it is off until this
+// is called.
+//
+// The measurements will be published under `name`. An empty name will
+// cause them to not be published; they remain available from
+// ReadSelfMetrics.
+func EnableSelfMetrics(name string) {
+	self.enabled.Store(true)
+	if name != "" {
+		publish(name, expvar.Func(func() interface{} {
+			return ReadSelfMetrics()
+		}))
+	}
+}
+
+// obtain the current self measurements
+func ReadSelfMetrics() SelfMetrics {
+	return SelfMetrics{
+		Updates:       self.updates.Load(),
+		UpdateNanos:   self.updateNanos.Load(),
+		LockWaitNanos: self.lockWaitNanos.Load(),
+		Values:        self.values.Load(),
+		ValueNanos:    self.valueNanos.Load(),
+		Scrapes:       self.scrapes.Load(),
+		ScrapeAllocs:  self.scrapeAllocs.Load(),
+		Published:     self.published.Load(),
+	}
+}
+
+// Wrap a handler serving stats, such as expvar.Handler(), so that the
+// heap allocations made while serving each request are counted in the
+// self metrics. The allocation count is process wide, so allocations
+// by other goroutines during a scrape are included.
+func MeasureScrapes(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !self.enabled.Load() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		before := heapAllocs()
+		h.ServeHTTP(w, r)
+		self.scrapes.Add(1)
+		self.scrapeAllocs.Add(int64(heapAllocs() - before))
+	})
+}
+
+// the number of heap objects allocated by the process so far
+func heapAllocs() uint64 {
+	sample := []metrics.Sample{{Name: "/gc/heap/allocs:objects"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// note the start of a measured call, returning the zero time when self
+// metrics are disabled
+func measureStart() time.Time {
+	if !self.enabled.Load() {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// record the time an update which started at `start` spent waiting
+// for its lock
+func recordLockWait(start time.Time) {
+	if !start.IsZero() {
+		self.lockWaitNanos.Add(int64(time.Since(start)))
+	}
+}
+
+// record an update which started at `start`
+func recordUpdate(start time.Time) {
+	if !start.IsZero() {
+		self.updates.Add(1)
+		self.updateNanos.Add(int64(time.Since(start)))
+	}
+}
+
+// record a value computation which started at `start`
+func recordValue(start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	self.values.Add(1)
+	self.valueNanos.Add(int64(time.Since(start)))
+}
+
+// publish a stat under `name`, unless the name is empty
+func publish(name string, v expvar.Var) {
+	if name == "" {
+		return
+	}
+	DefaultRegistry.Register(name, v)
+}
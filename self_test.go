@@ -0,0 +1,55 @@
+package variant
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSelfMetrics(t *testing.T) {
+	unregisterAfter(t, "test.self", "test.self.average")
+	EnableSelfMetrics("test.self")
+	before := ReadSelfMetrics()
+
+	s := NewSimpleMovingAverage("test.self.average", 3)
+	s.Update(1)
+	s.UpdateBatch([]float64{2, 3})
+	s.Value()
+
+	after := ReadSelfMetrics()
+	if n := after.Updates - before.Updates; n != 2 {
+		t.Errorf("expected 2 updates, got %d", n)
+	}
+	if n := after.Values - before.Values; n != 1 {
+		t.Errorf("expected 1 value, got %d", n)
+	}
+	if n := after.Published - before.Published; n != 1 {
+		t.Errorf("expected 1 published stat, got %d", n)
+	}
+	DefaultRegistry.Unregister("test.self.average")
+	if n := ReadSelfMetrics().Published - before.Published; n != 0 {
+		t.Errorf("expected Unregister to drop the published count, got %d more", n)
+	}
+	if after.UpdateNanos <= before.UpdateNanos {
+		t.Errorf("expected update time to be recorded")
+	}
+	if expvar.Get("test.self") == nil {
+		t.Errorf("expected self metrics to be published")
+	}
+}
+
+func TestMeasureScrapes(t *testing.T) {
+	EnableSelfMetrics("")
+	before := ReadSelfMetrics()
+
+	h := MeasureScrapes(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1024))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/debug/vars", nil))
+
+	after := ReadSelfMetrics()
+	if n := after.Scrapes - before.Scrapes; n != 1 {
+		t.Errorf("expected 1 scrape, got %d", n)
+	}
+}
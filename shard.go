@@ -0,0 +1,100 @@
+package variant
+
+import (
+	"math/rand/v2"
+	"runtime"
+)
+
+// the striped buffers a sharded SimpleMovingStat takes updates into
+type updateShards struct {
+	stripes []batchStripe
+}
+
+// Switch the stat to sharded updates: Update appends to one of
+// GOMAXPROCS striped buffers, chosen at random, and only takes the
+// stat's own lock to merge a full buffer into the window, so hundreds
+// of goroutines updating one stat mostly contend on different stripes.
+// Every read merges all the stripes first, so reads see every update
+// which returned before them, at the cost of locking each stripe.
+//
+// Values from different stripes enter the window in no particular
+// order, so when it is full which values are evicted first is only
+// roughly the oldest.
+//
+// Calling StartSharded on a stat which is already sharded does
+// nothing.
+func (s *SimpleMovingStat) StartSharded() {
+	sh := &updateShards{make([]batchStripe, runtime.GOMAXPROCS(0))}
+	for i := range sh.stripes {
+		sh.stripes[i].values = make([]float64, 0, batchStripeSize)
+	}
+	s.shards.CompareAndSwap(nil, sh)
+}
+
+// Return the stat to unsharded updates, merging whatever the stripes
+// hold. An Update racing with StopSharded may still land on a stripe
+// after it has been merged and be dropped, so quiesce producers first
+// if every sample matters.
+func (s *SimpleMovingStat) StopSharded() {
+	if sh := s.shards.Swap(nil); sh != nil {
+		s.mergeShards(sh)
+	}
+}
+
+// append a value to a randomly chosen stripe, merging the stripe when
+// it fills
+func (s *SimpleMovingStat) updateShard(sh *updateShards, val float64) {
+	st := &sh.stripes[rand.Uint32()%uint32(len(sh.stripes))]
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.values = append(st.values, val)
+	if len(st.values) >= batchStripeSize {
+		s.merge(st.values)
+		st.values = st.values[:0]
+	}
+}
+
+// merge every stripe into the window, if the stat is sharded
+func (s *SimpleMovingStat) collect() {
+	if sh := s.shards.Load(); sh != nil {
+		s.mergeShards(sh)
+	}
+}
+
+func (s *SimpleMovingStat) mergeShards(sh *updateShards) {
+	for i := range sh.stripes {
+		st := &sh.stripes[i]
+		st.mutex.Lock()
+		if len(st.values) > 0 {
+			s.merge(st.values)
+			st.values = st.values[:0]
+		}
+		st.mutex.Unlock()
+	}
+}
+
+// discard whatever the stripes hold, if the stat is sharded
+func (s *SimpleMovingStat) discardShards() {
+	sh := s.shards.Load()
+	if sh == nil {
+		return
+	}
+	for i := range sh.stripes {
+		st := &sh.stripes[i]
+		st.mutex.Lock()
+		st.values = st.values[:0]
+		st.mutex.Unlock()
+	}
+}
+
+// insert values into the window under the stat's lock, bypassing the
+// queue and stripes
+func (s *SimpleMovingStat) merge(vals []float64) {
+	s.lock()
+	defer s.unlock()
+	for _, val := range vals {
+		s.insert(val)
+	}
+	s.updated(len(vals))
+}
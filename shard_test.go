@@ -0,0 +1,68 @@
+package variant
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestShardedUpdates(t *testing.T) {
+	s := NewSimpleMovingAverage("", 100000)
+	s.StartSharded()
+	defer s.StopSharded()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 50; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				s.Update(2)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(s.Values()); n != 50000 {
+		t.Errorf("expected every update to be merged on read, got %d values", n)
+	}
+	if avg := s.Value(); avg != 2.0 {
+		t.Errorf("expected avg of 2.0, got %f", avg)
+	}
+	if problems := s.Audit(); len(problems) != 0 {
+		t.Errorf("unexpected findings %v", problems)
+	}
+}
+
+func TestShardedReset(t *testing.T) {
+	s := NewSimpleMovingAverage("", 10)
+	s.StartSharded()
+	s.Update(1)
+	s.Reset()
+	s.StopSharded()
+	if vals := s.Values(); len(vals) != 0 {
+		t.Errorf("expected Reset to discard buffered values, got %v", vals)
+	}
+	s.Update(3)
+	if vals := s.Values(); len(vals) != 1 || vals[0] != 3 {
+		t.Errorf("expected [3] once unsharded, got %v", vals)
+	}
+}
+
+// 32 goroutines per GOMAXPROCS hammering one stat, as with a few
+// hundred request handlers updating a shared latency stat
+func benchmarkContended(b *testing.B, sharded bool) {
+	s := NewSimpleMovingPercentile("", 0.99, 1000)
+	if sharded {
+		s.StartSharded()
+		defer s.StopSharded()
+	}
+	b.SetParallelism(32)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.Update(1)
+		}
+	})
+}
+
+func BenchmarkUpdateContendedLocked(b *testing.B)  { benchmarkContended(b, false) }
+func BenchmarkUpdateContendedSharded(b *testing.B) { benchmarkContended(b, true) }
@@ -44,3 +44,40 @@ func Test_smm_90p(t *testing.T) {
 		t.Errorf("expected median of 2.0, got %f", avg)
 	}
 }
+
+func Test_smm_set_percentile(t *testing.T) {
+	sma := NewSimpleMovingPercentile("", 0.5, 10)
+	for i := 1; i <= 10; i++ {
+		sma.Update(float64(i))
+	}
+	sma.SetPercentile(0.9)
+
+	avg := sma.Value()
+
+	if avg != 10.0 {
+		t.Errorf("expected 90th percentile of 10.0, got %f", avg)
+	}
+	if n := len(sma.Values()); n != 10 {
+		t.Errorf("expected window to be kept, got %d values", n)
+	}
+}
+
+func Test_smm_100p(t *testing.T) {
+	sma := NewSimpleMovingPercentile("", 1.0, 3)
+	sma.Update(3)
+	sma.Update(1)
+	sma.Update(2)
+
+	if avg := sma.Value(); avg != 3.0 {
+		t.Errorf("expected 100th percentile of 3.0, got %f", avg)
+	}
+}
+
+func Test_smm_set_percentile_out_of_range(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected SetPercentile to panic on 1.5")
+		}
+	}()
+	NewSimpleMovingPercentile("", 0.5, 3).SetPercentile(1.5)
+}
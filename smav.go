@@ -1,35 +1,58 @@
-/* 
-
- Package variant provides some (well, at the time of this writing)
- useful implementations of the expvar.Var interface (which is just a
- Stringer).
-
+/*
+Package variant provides some (well, at the time of this writing)
+useful implementations of the expvar.Var interface (which is just a
+Stringer).
 */
 package variant
 
 import (
 	"container/ring"
-	"expvar"
 	"fmt"
 	"math"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // represents a size bounded simple moving average
 // it is thread/goroutine safe
+//
+// Value reads aggregates kept up to date as values enter and leave
+// the window: a running sum for averages, O(1), and an order
+// statistic tree for percentiles, O(log n), neither allocating. It
+// holds the lock while it reads them, so it contends with Update
+// briefly but never copies the window.
+//
+// Values copies from an immutable snapshot of the window. By default
+// Update only marks the snapshot stale, and the first Values after a
+// burst of updates takes the lock to copy the window; later calls
+// take no lock until the next update. SetSnapshotInterval publishes
+// eagerly instead, so Values never takes the lock at all.
 type SimpleMovingStat struct {
-	size      int
-	mutex     *sync.Mutex
-	values    *ring.Ring
-	calculate func(*SimpleMovingStat) float64
+	size       int
+	mutex      *sync.Mutex
+	values     *ring.Ring
+	sum        runningSum
+	tree       *orderTree
+	ranked     bool
+	evicted    int
+	every      int
+	pending    int
+	dirty      atomic.Bool
+	started    time.Time
+	snapshot   atomic.Pointer[[]float64]
+	queue      atomic.Pointer[updateQueue]
+	shards     atomic.Pointer[updateShards]
+	percentile atomic.Uint64
+	calculate  func() float64
 }
 
 // Create a new simple moving median expvar.Var. It will be
 // published under `name` and maintain `size` values for
-// calculating the median. 
+// calculating the median.
 //
-// An empty name will cause it to not be published
+// An empty name will cause it to not be published.
 //
 // This is just a convenience helper for a SimpleMovingPercentile
 func NewSimpleMovingMedian(name string, size int) *SimpleMovingStat {
@@ -41,71 +64,124 @@ func NewSimpleMovingMedian(name string, size int) *SimpleMovingStat {
 // published under `name` and maintain `size` values for
 // calculating the percentile.
 //
-// percentile must be between 0 and 1 
+// percentile must be between 0 and 1
 //
 // An empty name will cause it to not be published
 func NewSimpleMovingPercentile(name string, percentile float64, size int) *SimpleMovingStat {
-	sm := new(SimpleMovingStat)
-	sm.size = size
-	sm.mutex = new(sync.Mutex)
-	sm.values = ring.New(size)
-
-	sm.calculate = func(s *SimpleMovingStat) float64 {
-		ary := make([]float64, 0)
-		s.values.Do(func(val interface{}) {
-			if val != nil {
-				ary = append(ary, val.(float64))
-			}
-		})
-		length := len(ary)
-		if length == 0 {
-			return 0.0
-		}
-		sort.Float64s(ary)
-		mid := int(float64(len(ary)) * percentile)
-		return ary[mid]
-	}
+	sm := newSimpleMovingStat(size)
+	sm.percentile.Store(math.Float64bits(percentile))
+	sm.tree = newOrderTree(size)
+	sm.ranked = true
 
-	if name != "" {
-		expvar.Publish(name, sm)
+	sm.calculate = func() float64 {
+		return sm.tree.percentile(math.Float64frombits(sm.percentile.Load()))
 	}
+
+	publish(name, sm)
 	return sm
 
 }
 
 // Create a new simple moving average expvar.Var. It will be
 // published under `name` and maintain `size` values for
-// calculating the average. 
+// calculating the average.
 //
 // An empty name will cause it to not be published
 func NewSimpleMovingAverage(name string, size int) *SimpleMovingStat {
-	sma := new(SimpleMovingStat)
-	sma.size = size
-	sma.mutex = new(sync.Mutex)
-	sma.values = ring.New(size)
+	sma := newSimpleMovingStat(size)
+
+	sma.calculate = sma.sum.mean
+
+	publish(name, sma)
+	return sma
+}
 
-	sma.calculate = func(s *SimpleMovingStat) float64 {
-		var sum float64 = 0.0
-		var cnt int = 0
+// Create a new simple moving minimum expvar.Var. It will be published
+// under `name` and report the smallest of the last `size` values, or
+// NaN before there are any.
+//
+// An empty name will cause it to not be published.
+func NewMovingMin(name string, size int) *SimpleMovingStat {
+	return newMovingExtreme(name, size, false)
+}
+
+// Create a new simple moving maximum expvar.Var. It will be published
+// under `name` and report the largest of the last `size` values, or
+// NaN before there are any.
+//
+// An empty name will cause it to not be published.
+func NewMovingMax(name string, size int) *SimpleMovingStat {
+	return newMovingExtreme(name, size, true)
+}
+
+func newMovingExtreme(name string, size int, largest bool) *SimpleMovingStat {
+	sm := newSimpleMovingStat(size)
+	sm.tree = newOrderTree(size)
 
-		s.values.Do(func(val interface{}) {
-			if val != nil {
-				cnt++
-				sum = sum + val.(float64)
-			}
-		})
-		return sum / float64(cnt)
+	sm.calculate = func() float64 {
+		n := sm.tree.len()
+		switch {
+		case n == 0:
+			return math.NaN()
+		case largest:
+			return sm.tree.nth(n - 1)
+		}
+		return sm.tree.nth(0)
 	}
 
-	if name != "" {
-		expvar.Publish(name, sma)
+	publish(name, sm)
+	return sm
+}
+
+// the average of `values`, NaN when there are none
+func mean(values []float64) float64 {
+	var sum float64 = 0.0
+
+	for _, val := range values {
+		sum = sum + val
 	}
-	return sma
+	return sum / float64(len(values))
+}
+
+// the `percentile` of `values`, 0 when there are none. The values are
+// left untouched, as they may be shared with other readers.
+func percentileOf(values []float64, percentile float64) float64 {
+	length := len(values)
+	if length == 0 {
+		return 0.0
+	}
+	ary := make([]float64, length)
+	copy(ary, values)
+	sort.Float64s(ary)
+	return percentileOfSorted(ary, percentile)
+}
+
+// the `percentile` of `sorted`, which must be in ascending order and
+// not empty
+func percentileOfSorted(sorted []float64, percentile float64) float64 {
+	mid := int(float64(len(sorted)) * percentile)
+	if mid >= len(sorted) {
+		mid = len(sorted) - 1
+	}
+	return sorted[mid]
+}
+
+func newSimpleMovingStat(size int) *SimpleMovingStat {
+	s := new(SimpleMovingStat)
+	s.size = size
+	s.mutex = new(sync.Mutex)
+	s.values = ring.New(size)
+	s.snapshot.Store(new([]float64))
+	return s
 }
 
 // display the value as a string
 func (s *SimpleMovingStat) String() string {
-	v := s.Value()
+	return formatFloat(s.Value())
+}
+
+// render a float as JSON, quoting the values JSON has no literal for
+func formatFloat(v float64) string {
 	if math.IsNaN(v) {
 		return `"NaN"`
 	}
@@ -115,21 +191,222 @@ func (s *SimpleMovingStat) String() string {
 	if math.IsInf(v, -1) {
 		return `"-Infinity"`
 	}
-	return fmt.Sprintf("%f", s.Value())
+	return fmt.Sprintf("%f", v)
 }
 
 // Append a new value to the stat
 func (s *SimpleMovingStat) Update(val float64) {
+	if q := s.queue.Load(); q != nil {
+		q.push(val)
+		return
+	}
+	if sh := s.shards.Load(); sh != nil {
+		s.updateShard(sh, val)
+		return
+	}
+
+	s.lock()
+	defer s.unlock()
+
+	s.insert(val)
+	s.updated(1)
+}
+
+// Append several values to the stat, taking the lock and publishing
+// a snapshot once for the whole batch
+func (s *SimpleMovingStat) UpdateBatch(vals []float64) {
+	if q := s.queue.Load(); q != nil {
+		for _, val := range vals {
+			q.push(val)
+		}
+		return
+	}
+	s.merge(vals)
+}
+
+// Discard every value in the window
+func (s *SimpleMovingStat) Reset() {
+	s.discardShards()
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	s.values = ring.New(s.size)
+	s.clear()
+	s.publish()
+}
 
+// Change the number of values the window holds, keeping the most
+// recent ones that still fit. Sizes less than 1 are treated as 1.
+func (s *SimpleMovingStat) Resize(size int) {
+	if size < 1 {
+		size = 1
+	}
+	s.collect()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old := s.values
+	s.size = size
+	s.values = ring.New(size)
+	s.clear()
+	old.Do(func(val interface{}) {
+		if val != nil {
+			s.insert(val.(float64))
+		}
+	})
+	s.publish()
+}
+
+// Change the percentile a percentile stat reports, keeping the values
+// already in the window. It has no effect on averages.
+//
+// percentile must be between 0 and 1, otherwise SetPercentile panics
+func (s *SimpleMovingStat) SetPercentile(percentile float64) {
+	if !(percentile >= 0 && percentile <= 1) {
+		panic("variant: percentile must be between 0 and 1")
+	}
+	s.percentile.Store(math.Float64bits(percentile))
+}
+
+// obtain the percentile a percentile stat reports, and false for
+// other stats
+func (s *SimpleMovingStat) ReportedPercentile() (float64, bool) {
+	if !s.ranked {
+		return 0, false
+	}
+	return math.Float64frombits(s.percentile.Load()), true
+}
+
+// take the mutex for an update, measuring it if self metrics are on
+func (s *SimpleMovingStat) lock() {
+	start := measureStart()
+	s.mutex.Lock()
+	recordLockWait(start)
+	s.started = start
+}
+
+// release the mutex taken by lock
+func (s *SimpleMovingStat) unlock() {
+	start := s.started
+	s.mutex.Unlock()
+	recordUpdate(start)
+}
+
+// store a value in the ring, evicting the oldest once it is full.
+// Must be called with the mutex held.
+func (s *SimpleMovingStat) insert(val float64) {
+	if old, ok := s.values.Value.(float64); ok {
+		s.sum.remove(old)
+		if s.tree != nil {
+			s.tree.remove(old)
+		}
+		s.evicted++
+	}
 	s.values.Value = val
 	s.values = s.values.Next()
+	s.sum.add(val)
+	if s.tree != nil {
+		s.tree.insert(val)
+	}
+
+	// adding and subtracting accumulates rounding error, so resum
+	// exactly once per window's worth of evictions, which keeps the
+	// cost amortized O(1)
+	if s.evicted >= s.size {
+		s.resum()
+	}
+}
+
+// recompute the running sum from the ring. Must be called with the
+// mutex held.
+func (s *SimpleMovingStat) resum() {
+	s.sum = runningSum{}
+	s.values.Do(func(val interface{}) {
+		if val != nil {
+			s.sum.add(val.(float64))
+		}
+	})
+	s.evicted = 0
+}
+
+// forget the aggregates of an emptied window. Must be called with the
+// mutex held.
+func (s *SimpleMovingStat) clear() {
+	s.sum = runningSum{}
+	s.evicted = 0
+	if s.tree != nil {
+		s.tree = newOrderTree(s.size)
+	}
+}
+
+// note `n` values were inserted. Must be called with the mutex held.
+func (s *SimpleMovingStat) updated(n int) {
+	if s.every == 0 {
+		s.dirty.Store(true)
+		return
+	}
+	s.pending += n
+	if s.pending >= s.every {
+		s.publish()
+	}
 }
 
-// obtain the current value
+// Publish a fresh snapshot eagerly every `k` updates, so that Values
+// never takes the lock, e.g. when many exporters read concurrently.
+// Copying the window is O(size) per publish, and Values lags by up to
+// k-1 updates. A `k` less than 1 restores the default of publishing
+// lazily on the first read after an update.
+func (s *SimpleMovingStat) SetSnapshotInterval(k int) {
+	if k < 1 {
+		k = 0
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.every = k
+	s.publish()
+}
+
+// copy the window, oldest first, into a new snapshot for readers.
+// Must be called with the mutex held.
+func (s *SimpleMovingStat) publish() {
+	ary := make([]float64, 0, s.size)
+	s.values.Do(func(val interface{}) {
+		if val != nil {
+			ary = append(ary, val.(float64))
+		}
+	})
+	s.snapshot.Store(&ary)
+	s.pending = 0
+	s.dirty.Store(false)
+}
+
+// the current snapshot, refreshing it first if it is stale
+func (s *SimpleMovingStat) current() []float64 {
+	if s.dirty.Load() {
+		s.mutex.Lock()
+		if s.dirty.Load() {
+			s.publish()
+		}
+		s.mutex.Unlock()
+	}
+	return *s.snapshot.Load()
+}
+
+// obtain the current value, taking the lock to read the running
+// aggregates
 func (s *SimpleMovingStat) Value() float64 {
+	start := measureStart()
+	defer recordValue(start)
+	s.collect()
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	return s.calculate(s)
+	return s.calculate()
+}
+
+// obtain a copy of the values in the window, oldest first
+func (s *SimpleMovingStat) Values() []float64 {
+	s.collect()
+	values := s.current()
+	ary := make([]float64, len(values))
+	copy(ary, values)
+	return ary
 }
@@ -3,6 +3,7 @@ package variant
 import (
 	"expvar"
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -61,3 +62,221 @@ func TestSliceBehavior(t *testing.T) {
 		t.Errorf("expected len=2, got len=%d", len(ary))
 	}
 }
+
+func TestValuesOldestFirst(t *testing.T) {
+	s := NewSimpleMovingAverage("", 3)
+	s.Update(1)
+	s.Update(2)
+	s.Update(3)
+	s.Update(4)
+	vals := s.Values()
+	if len(vals) != 3 || vals[0] != 2 || vals[1] != 3 || vals[2] != 4 {
+		t.Errorf("expected [2 3 4], got %v", vals)
+	}
+}
+
+func TestValuesIsACopy(t *testing.T) {
+	s := NewSimpleMovingAverage("", 2)
+	s.Update(1)
+	vals := s.Values()
+	vals[0] = 100
+	if avg := s.Value(); avg != 1.0 {
+		t.Errorf("expected avg of 1.0, got %f", avg)
+	}
+}
+
+func TestSnapshotInterval(t *testing.T) {
+	s := NewSimpleMovingAverage("", 10)
+	s.SetSnapshotInterval(3)
+	s.Update(1)
+	s.Update(2)
+	if n := len(s.Values()); n != 0 {
+		t.Errorf("expected no published values yet, got %d", n)
+	}
+	s.Update(3)
+	if avg := s.Value(); avg != 2.0 {
+		t.Errorf("expected avg of 2.0, got %f", avg)
+	}
+}
+
+func TestConcurrentReaders(t *testing.T) {
+	s := NewSimpleMovingPercentile("", 0.5, 100)
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			for j := 0; j < 1000; j++ {
+				s.Value()
+				s.Values()
+			}
+			done <- true
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		s.Update(float64(i))
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+}
+
+func TestReset(t *testing.T) {
+	s := NewSimpleMovingAverage("", 3)
+	s.Update(1)
+	s.Reset()
+	s.Update(4)
+	if avg := s.Value(); avg != 4.0 {
+		t.Errorf("expected avg of 4.0, got %f", avg)
+	}
+}
+
+func TestResizeKeepsNewest(t *testing.T) {
+	s := NewSimpleMovingAverage("", 3)
+	s.Update(1)
+	s.Update(2)
+	s.Update(3)
+	s.Resize(2)
+	if vals := s.Values(); len(vals) != 2 || vals[0] != 2 || vals[1] != 3 {
+		t.Errorf("expected [2 3], got %v", vals)
+	}
+	s.Resize(4)
+	s.Update(4)
+	s.Update(5)
+	if vals := s.Values(); len(vals) != 4 || vals[0] != 2 || vals[3] != 5 {
+		t.Errorf("expected [2 3 4 5], got %v", vals)
+	}
+}
+
+func TestLazySnapshot(t *testing.T) {
+	s := NewSimpleMovingAverage("", 10)
+	s.Update(1)
+	if !s.dirty.Load() {
+		t.Errorf("expected Update to leave the snapshot stale")
+	}
+	if avg := s.Value(); avg != 1.0 {
+		t.Errorf("expected avg of 1.0, got %f", avg)
+	}
+	if !s.dirty.Load() {
+		t.Errorf("expected Value to leave the snapshot alone")
+	}
+	if vals := s.Values(); len(vals) != 1 {
+		t.Errorf("expected [1], got %v", vals)
+	}
+	if s.dirty.Load() {
+		t.Errorf("expected the read to refresh the snapshot")
+	}
+	s.SetSnapshotInterval(0)
+	s.Update(3)
+	if avg := s.Value(); avg != 2.0 {
+		t.Errorf("expected avg of 2.0, got %f", avg)
+	}
+}
+
+func benchmarkUpdate(b *testing.B, size int) {
+	s := NewSimpleMovingAverage("", size)
+	for i := 0; i < b.N; i++ {
+		s.Update(float64(i))
+	}
+}
+
+func BenchmarkUpdateWindow100(b *testing.B)   { benchmarkUpdate(b, 100) }
+func BenchmarkUpdateWindow10000(b *testing.B) { benchmarkUpdate(b, 10000) }
+
+func benchmarkEagerUpdate(b *testing.B, size int) {
+	s := NewSimpleMovingAverage("", size)
+	s.SetSnapshotInterval(1)
+	for i := 0; i < b.N; i++ {
+		s.Update(float64(i))
+	}
+}
+
+func BenchmarkEagerUpdateWindow100(b *testing.B)   { benchmarkEagerUpdate(b, 100) }
+func BenchmarkEagerUpdateWindow10000(b *testing.B) { benchmarkEagerUpdate(b, 10000) }
+
+func TestResizeClampsToOne(t *testing.T) {
+	s := NewSimpleMovingAverage("", 3)
+	s.Update(1)
+	s.Update(2)
+	s.Resize(0)
+	s.Update(3)
+	if vals := s.Values(); len(vals) != 1 || vals[0] != 3 {
+		t.Errorf("expected [3], got %v", vals)
+	}
+}
+
+// Value against a full 10k window, incrementally and, for comparison,
+// the way it used to be computed: copying, and for percentiles
+// sorting, the whole window on every read
+func BenchmarkValueAverage(b *testing.B) {
+	s := NewSimpleMovingAverage("", 10000)
+	for i := 0; i < 10000; i++ {
+		s.Update(float64(i))
+	}
+	b.Run("incremental", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.Value()
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			mean(s.Values())
+		}
+	})
+}
+
+func BenchmarkValuePercentile(b *testing.B) {
+	s := NewSimpleMovingPercentile("", 0.99, 10000)
+	for i := 0; i < 10000; i++ {
+		s.Update(float64(i * 7919 % 10000))
+	}
+	b.Run("incremental", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.Value()
+		}
+	})
+	b.Run("sort", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			percentileOf(s.Values(), 0.99)
+		}
+	})
+}
+
+func BenchmarkUpdatePercentileWindow10000(b *testing.B) {
+	s := NewSimpleMovingPercentile("", 0.99, 10000)
+	for i := 0; i < b.N; i++ {
+		s.Update(float64(i))
+	}
+}
+
+func TestReportedPercentile(t *testing.T) {
+	if _, ok := NewSimpleMovingAverage("", 3).ReportedPercentile(); ok {
+		t.Errorf("expected an average to report no percentile")
+	}
+	if p, ok := NewSimpleMovingPercentile("", 0.9, 3).ReportedPercentile(); !ok || p != 0.9 {
+		t.Errorf("expected 0.9, got %f %v", p, ok)
+	}
+}
+
+func TestMovingMinMax(t *testing.T) {
+	min, max := NewMovingMin("", 3), NewMovingMax("", 3)
+	if v := min.Value(); !math.IsNaN(v) {
+		t.Errorf("expected NaN for an empty window, got %f", v)
+	}
+	for _, val := range []float64{5, 1, 9, 4, 6} {
+		min.Update(val)
+		max.Update(val)
+	}
+	// the window is now [9 4 6]
+	if v := min.Value(); v != 4.0 {
+		t.Errorf("expected min of 4.0, got %f", v)
+	}
+	if v := max.Value(); v != 9.0 {
+		t.Errorf("expected max of 9.0, got %f", v)
+	}
+	if _, ok := max.ReportedPercentile(); ok {
+		t.Errorf("expected a maximum to report no percentile")
+	}
+}
@@ -0,0 +1,253 @@
+package variant
+
+import (
+	"expvar"
+	"time"
+)
+
+// A typed copy of a stat's state at one moment, for programs which
+// would otherwise parse String. Figures may be NaN or infinite, which
+// encoding/json refuses to marshal, so check before encoding one.
+type Snapshot struct {
+	// when the snapshot was taken
+	Time time.Time
+	// how many values the figures cover, or for counters and meters
+	// the count itself
+	Count int64
+	// what the stat's Value method returns, or 0 for stats which
+	// report several figures in Fields instead
+	Value float64
+	// the values in the window, oldest first where the stat keeps
+	// them in order, or nil for stats which keep none
+	Values []float64
+	// the named figures of stats which report several, keyed as
+	// String renders them, e.g. "p99" or "m1"
+	Fields map[string]float64
+}
+
+// Implemented by every variant stat
+type Snapshotter interface {
+	Snapshot() Snapshot
+}
+
+// Snapshot every published stat which supports it, keyed by name.
+// Stats which reset when read, such as Delta, are left out, so taking
+// snapshots steals nothing from their reader.
+func Snapshots() map[string]Snapshot {
+	snapshots := make(map[string]Snapshot)
+	Do(func(kv expvar.KeyValue) {
+		if _, ok := kv.Value.(readResetter); ok {
+			return
+		}
+		if s, ok := kv.Value.(Snapshotter); ok {
+			snapshots[kv.Key] = s.Snapshot()
+		}
+	})
+	return snapshots
+}
+
+// the figures of a summary, keyed as String renders them
+func summaryFields(sum Summary) map[string]float64 {
+	fields := map[string]float64{
+		"count":  float64(sum.Count),
+		"min":    sum.Min,
+		"max":    sum.Max,
+		"mean":   sum.Mean,
+		"stddev": sum.StdDev,
+	}
+	for i, p := range sum.Percentiles {
+		fields[percentileKey(p)] = sum.Quantiles[i]
+	}
+	return fields
+}
+
+// render the stat as JSON, the same as String
+func (s *SimpleMovingStat) MarshalJSON() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// take a consistent copy of the window and its value
+func (s *SimpleMovingStat) Snapshot() Snapshot {
+	s.collect()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	values := make([]float64, 0, s.size)
+	s.values.Do(func(val interface{}) {
+		if val != nil {
+			values = append(values, val.(float64))
+		}
+	})
+	return Snapshot{Time: time.Now(), Count: int64(len(values)), Value: s.calculate(), Values: values}
+}
+
+// render the stat as JSON, the same as String
+func (t *TimedMovingStat) MarshalJSON() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// take a consistent copy of the window and its value
+func (t *TimedMovingStat) Snapshot() Snapshot {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expire()
+	// calculate may reorder the values it is given
+	values := t.values()
+	value := t.calculate(append([]float64(nil), values...))
+	return Snapshot{Time: t.now(), Count: int64(len(values)), Value: value, Values: values}
+}
+
+// render the summary as JSON, the same as String
+func (m *MovingSummary) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// take a consistent copy of the window and its figures
+func (m *MovingSummary) Snapshot() Snapshot {
+	m.mutex.Lock()
+	values := m.window()
+	percentiles := m.percentiles
+	m.mutex.Unlock()
+
+	sum := summarize(append([]float64(nil), values...), percentiles)
+	return Snapshot{Time: time.Now(), Count: int64(sum.Count), Values: values, Fields: summaryFields(sum)}
+}
+
+// render the timer as JSON, the same as String
+func (t *Timer) MarshalJSON() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// take a consistent copy of the window and its figures, in the
+// timer's unit
+func (t *Timer) Snapshot() Snapshot {
+	return t.summary.Snapshot()
+}
+
+// render the meter as JSON, the same as String
+func (m *Meter) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// take a copy of the count and rates. The rates are in Fields, keyed
+// "m1", "m5", "m15" and "mean".
+func (m *Meter) Snapshot() Snapshot {
+	rates := m.Rates()
+	return Snapshot{
+		Time:  time.Now(),
+		Count: rates.Count,
+		Fields: map[string]float64{
+			"m1":   rates.Rate1,
+			"m5":   rates.Rate5,
+			"m15":  rates.Rate15,
+			"mean": rates.Mean,
+		},
+	}
+}
+
+// render the reservoir percentile as JSON, the same as String
+func (r *ReservoirPercentile) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// take a consistent copy of the reservoir and its value. Values are in
+// no particular order.
+func (r *ReservoirPercentile) Snapshot() Snapshot {
+	r.mutex.Lock()
+	samples := append([]reservoirSample(nil), r.samples...)
+	percentile := r.percentile
+	now := r.now()
+	r.mutex.Unlock()
+
+	values := make([]float64, len(samples))
+	for i, s := range samples {
+		values[i] = s.value
+	}
+	return Snapshot{Time: now, Count: int64(len(values)), Value: weightedPercentile(samples, percentile), Values: values}
+}
+
+// render the histogram as JSON, the same as String
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// take a consistent copy of the figures. Fields hold "sum", "min",
+// "max" and the percentiles; the buckets are left to Buckets.
+func (h *Histogram) Snapshot() Snapshot {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	buckets := h.buckets()
+	fields := map[string]float64{"sum": h.sum, "min": h.min, "max": h.max}
+	for _, p := range h.percentiles {
+		fields[percentileKey(p)] = estimatePercentile(buckets, h.gamma, h.count, h.min, h.max, p)
+	}
+	return Snapshot{Time: time.Now(), Count: h.count, Fields: fields}
+}
+
+// render the family as JSON, the same as String
+func (f *StatFamily) MarshalJSON() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// take a copy of every child's value, keyed in Fields as String
+// renders them. Count is the number of children.
+func (f *StatFamily) Snapshot() Snapshot {
+	fields := make(map[string]float64)
+	f.Each(func(labels []string, s *SimpleMovingStat) {
+		fields[f.label(labels)] = s.Value()
+	})
+	return Snapshot{Time: time.Now(), Count: int64(len(fields)), Fields: fields}
+}
+
+// render the gauge as JSON, the same as String
+func (g *Gauge) MarshalJSON() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// take a copy of the value
+func (g *Gauge) Snapshot() Snapshot {
+	return Snapshot{Time: time.Now(), Value: g.Value()}
+}
+
+// render the value as JSON, the same as String
+func (f FloatFunc) MarshalJSON() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// call the function and take its value
+func (f FloatFunc) Snapshot() Snapshot {
+	return Snapshot{Time: time.Now(), Value: f()}
+}
+
+// render the counter as JSON, the same as String
+func (c *Int) MarshalJSON() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// take a copy of the count
+func (c *Int) Snapshot() Snapshot {
+	v := c.Value()
+	return Snapshot{Time: time.Now(), Count: v, Value: float64(v)}
+}
+
+// render the delta as JSON, the same as String. Like Value, this
+// counts as a read.
+func (d *Delta) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// take the change since the previous read. Like Value, this counts as
+// a read.
+func (d *Delta) Snapshot() Snapshot {
+	v := d.Value()
+	return Snapshot{Time: time.Now(), Count: v, Value: float64(v)}
+}
+
+// render the rate as JSON, the same as String
+func (r *CounterRate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// take the current rate
+func (r *CounterRate) Snapshot() Snapshot {
+	return Snapshot{Time: r.now(), Value: r.Value()}
+}
@@ -0,0 +1,73 @@
+package variant
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	s := NewSimpleMovingAverage("", 3)
+	s.Update(2)
+	m := NewMovingSummary("", 3, 0.5)
+	m.Update(2)
+	out, err := json.Marshal(map[string]interface{}{
+		"avg":     s,
+		"summary": m,
+		"gauge":   NewGauge(""),
+		"func":    NewFloatFunc("", func() float64 { return 1 }),
+		"meter":   NewMeter(""),
+		"timer":   NewTimer("", time.Millisecond, 3),
+		"family":  NewMovingAverageFamily("", 3, "route"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(out, &body); err != nil {
+		t.Fatalf("invalid json %s: %v", out, err)
+	}
+	if body["avg"] != 2.0 || body["summary"].(map[string]interface{})["p50"] != 2.0 {
+		t.Errorf("unexpected rendering %s", out)
+	}
+}
+
+func TestSnapshotWindow(t *testing.T) {
+	s := NewSimpleMovingPercentile("", 0.5, 3)
+	s.UpdateBatch([]float64{4, 1, 3, 2})
+	snap := s.Snapshot()
+	if snap.Count != 3 || snap.Value != 2 || len(snap.Values) != 3 || snap.Values[0] != 1 || snap.Values[2] != 2 {
+		t.Errorf("unexpected snapshot %+v", snap)
+	}
+	if snap.Time.IsZero() {
+		t.Errorf("expected the snapshot to be timestamped")
+	}
+}
+
+func TestSnapshotFields(t *testing.T) {
+	m := NewMovingSummary("", 10, 0.99)
+	m.UpdateBatch([]float64{1, 3})
+	snap := m.Snapshot()
+	if snap.Count != 2 || snap.Fields["mean"] != 2 || snap.Fields["p99"] != 3 || snap.Fields["max"] != 3 {
+		t.Errorf("unexpected snapshot %+v", snap)
+	}
+
+	f := NewMovingAverageFamily("", 10, "route")
+	f.WithLabels("/a").Update(5)
+	if snap := f.Snapshot(); snap.Count != 1 || snap.Fields["route=/a"] != 5 {
+		t.Errorf("unexpected family snapshot %+v", snap)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	unregisterAfter(t, "test.snapshot.count", "test.snapshot.delta")
+	NewInt("test.snapshot.count").Add(3)
+	NewDelta("test.snapshot.delta", NewInt(""))
+	snaps := Snapshots()
+	if snap, ok := snaps["test.snapshot.count"]; !ok || snap.Count != 3 {
+		t.Errorf("expected the counter in the snapshots, got %+v", snap)
+	}
+	if _, ok := snaps["test.snapshot.delta"]; ok {
+		t.Errorf("expected the delta to be left out")
+	}
+}
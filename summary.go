@@ -0,0 +1,198 @@
+package variant
+
+import (
+	"container/ring"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the percentiles a MovingSummary reports unless told otherwise
+var defaultSummaryPercentiles = []float64{0.50, 0.95, 0.99}
+
+// represents a size bounded window summarised several ways at once:
+// count, min, max, mean, standard deviation and percentiles, all
+// computed from one copy of the values
+// it is thread/goroutine safe
+type MovingSummary struct {
+	size        int
+	mutex       *sync.Mutex
+	values      *ring.Ring
+	percentiles []float64
+}
+
+// Create a new moving summary expvar.Var. It will be published under
+// `name` and maintain `size` values, rendering as a JSON object such
+// as
+//
+//	{"count":3,"min":1.000000,"max":9.000000,"mean":4.000000,"stddev":3.559026,"p50":2.000000}
+//
+// with one "p" key per percentile. With no percentiles it reports
+// p50, p95 and p99.
+//
+// percentiles must be between 0 and 1
+//
+// An empty name will cause it to not be published.
+func NewMovingSummary(name string, size int, percentiles ...float64) *MovingSummary {
+	if len(percentiles) == 0 {
+		percentiles = defaultSummaryPercentiles
+	}
+	m := new(MovingSummary)
+	m.size = size
+	m.mutex = new(sync.Mutex)
+	m.values = ring.New(size)
+	m.percentiles = checkPercentiles(percentiles)
+	publish(name, m)
+	return m
+}
+
+// a copy of `percentiles`, panicking if any is outside [0, 1]
+func checkPercentiles(percentiles []float64) []float64 {
+	for _, p := range percentiles {
+		if !(p >= 0 && p <= 1) {
+			panic("variant: percentile must be between 0 and 1")
+		}
+	}
+	return append([]float64(nil), percentiles...)
+}
+
+// a snapshot of the figures a MovingSummary reports
+type Summary struct {
+	Count  int
+	Min    float64
+	Max    float64
+	Mean   float64
+	StdDev float64
+	// the reported percentiles, in the order they were configured
+	Percentiles []float64
+	// the values of Percentiles, 0 when the window is empty
+	Quantiles []float64
+}
+
+// display the summary as a JSON object
+func (m *MovingSummary) String() string {
+	sum := m.Summary()
+
+	var b strings.Builder
+	b.WriteString(`{"count":`)
+	b.WriteString(strconv.Itoa(sum.Count))
+	b.WriteString(`,"min":`)
+	b.WriteString(formatFloat(sum.Min))
+	b.WriteString(`,"max":`)
+	b.WriteString(formatFloat(sum.Max))
+	b.WriteString(`,"mean":`)
+	b.WriteString(formatFloat(sum.Mean))
+	b.WriteString(`,"stddev":`)
+	b.WriteString(formatFloat(sum.StdDev))
+	for i, p := range sum.Percentiles {
+		b.WriteString(`,"`)
+		b.WriteString(percentileKey(p))
+		b.WriteString(`":`)
+		b.WriteString(formatFloat(sum.Quantiles[i]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// the key a percentile is reported under, e.g. "p99" or "p99.9"
+func percentileKey(p float64) string {
+	return "p" + strconv.FormatFloat(p*100, 'g', 6, 64)
+}
+
+// Append a new value to the summary
+func (m *MovingSummary) Update(val float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.values.Value = val
+	m.values = m.values.Next()
+}
+
+// Append several values to the summary, taking the lock once
+func (m *MovingSummary) UpdateBatch(vals []float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, val := range vals {
+		m.values.Value = val
+		m.values = m.values.Next()
+	}
+}
+
+// Discard every value in the window
+func (m *MovingSummary) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.values = ring.New(m.size)
+}
+
+// Change the percentiles the summary reports, keeping the values
+// already in the window.
+//
+// percentiles must be between 0 and 1, otherwise SetPercentiles panics
+func (m *MovingSummary) SetPercentiles(percentiles ...float64) {
+	checked := checkPercentiles(percentiles)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.percentiles = checked
+}
+
+// obtain a copy of the values in the window, oldest first
+func (m *MovingSummary) Values() []float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.window()
+}
+
+// the values in the window, oldest first. Must be called with the
+// mutex held.
+func (m *MovingSummary) window() []float64 {
+	ary := make([]float64, 0, m.size)
+	m.values.Do(func(val interface{}) {
+		if val != nil {
+			ary = append(ary, val.(float64))
+		}
+	})
+	return ary
+}
+
+// compute every figure over the current window. Min, Max, Mean and
+// StdDev are NaN when the window is empty.
+func (m *MovingSummary) Summary() Summary {
+	m.mutex.Lock()
+	values := m.window()
+	percentiles := m.percentiles
+	m.mutex.Unlock()
+	return summarize(values, percentiles)
+}
+
+// compute every figure over `values`, which are sorted in place
+func summarize(values []float64, percentiles []float64) Summary {
+	sum := Summary{
+		Count:       len(values),
+		Min:         math.NaN(),
+		Max:         math.NaN(),
+		Mean:        mean(values),
+		StdDev:      math.NaN(),
+		Percentiles: append([]float64(nil), percentiles...),
+		Quantiles:   make([]float64, len(percentiles)),
+	}
+	if len(values) == 0 {
+		return sum
+	}
+
+	var squares float64
+	for _, val := range values {
+		squares += (val - sum.Mean) * (val - sum.Mean)
+	}
+	sum.StdDev = math.Sqrt(squares / float64(len(values)))
+
+	// sort once for every percentile
+	sort.Float64s(values)
+	sum.Min = values[0]
+	sum.Max = values[len(values)-1]
+	for i, p := range percentiles {
+		sum.Quantiles[i] = percentileOfSorted(values, p)
+	}
+	return sum
+}
@@ -0,0 +1,66 @@
+package variant
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"testing"
+)
+
+func TestSummaryAsVar(t *testing.T) {
+	var _ expvar.Var = NewMovingSummary("", 3)
+}
+
+func TestSummaryString(t *testing.T) {
+	m := NewMovingSummary("", 3)
+	m.Update(100)
+	m.UpdateBatch([]float64{1, 2, 9})
+
+	want := `{"count":3,"min":1.000000,"max":9.000000,"mean":4.000000,"stddev":3.559026,"p50":2.000000,"p95":9.000000,"p99":9.000000}`
+	if got := m.String(); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestSummaryPercentiles(t *testing.T) {
+	m := NewMovingSummary("", 1000, 0.5, 0.999)
+	for i := 0; i < 1000; i++ {
+		m.Update(float64(i))
+	}
+	var body map[string]float64
+	if err := json.Unmarshal([]byte(m.String()), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", m.String(), err)
+	}
+	if body["p50"] != 500 || body["p99.9"] != 999 {
+		t.Errorf("expected p50 500 and p99.9 999, got %v", body)
+	}
+
+	m.SetPercentiles(0.9)
+	sum := m.Summary()
+	if len(sum.Quantiles) != 1 || sum.Quantiles[0] != 900 {
+		t.Errorf("expected only p90 of 900, got %v", sum.Quantiles)
+	}
+}
+
+func TestSummaryEmpty(t *testing.T) {
+	m := NewMovingSummary("", 3)
+	m.Update(1)
+	m.Reset()
+	sum := m.Summary()
+	if sum.Count != 0 || !math.IsNaN(sum.Mean) || !math.IsNaN(sum.Min) {
+		t.Errorf("expected an empty summary, got %+v", sum)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(m.String()), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", m.String(), err)
+	}
+}
+
+func TestSummaryRejectsPercentiles(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a percentile above 1")
+		}
+	}()
+	NewMovingSummary("", 3, 0.5, 1.5)
+}
@@ -0,0 +1,122 @@
+package variant
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Send `state`, e.g. "READY=1" or "WATCHDOG=1", to the service manager
+// listening on $NOTIFY_SOCKET, as sd_notify(3) does. It reports false
+// without an error when the process was not started by systemd.
+func Notify(state string) (bool, error) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return false, nil
+	}
+	conn, err := net.Dial("unixgram", addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// A health check consulted before each watchdog ping. It returns nil
+// when healthy, or an error describing what is wrong.
+type HealthCheck func() error
+
+// Implemented by stats with a float value
+type FloatSource interface {
+	Value() float64
+}
+
+// Create a health check failing while `source` is above `max`, e.g.
+// an error rate or a latency percentile
+func MaxValue(name string, source FloatSource, max float64) HealthCheck {
+	return func() error {
+		if v := source.Value(); v > max {
+			return fmt.Errorf("%s is %f, above %f", name, v, max)
+		}
+		return nil
+	}
+}
+
+// Create a health check failing when `heartbeat`, holding the Unix
+// time in seconds of the last sign of life, is older than `maxAge`.
+// Some loop which must keep running sets it:
+//
+//	heartbeat.Set(float64(time.Now().Unix()))
+func Fresh(name string, heartbeat *Gauge, maxAge time.Duration) HealthCheck {
+	return func() error {
+		last := time.Unix(0, int64(heartbeat.Value()*float64(time.Second)))
+		if age := time.Since(last); age > maxAge {
+			return fmt.Errorf("%s last beat %s ago", name, age.Truncate(time.Second))
+		}
+		return nil
+	}
+}
+
+// Watchdog turns health checks into systemd supervision signals. Once
+// every check passes it reports READY=1, and from then on pings
+// WATCHDOG=1 only while every check still passes, so with
+// WatchdogSec= set in the unit systemd restarts a process which has
+// stopped being healthy. Failures are reported in STATUS=.
+type Watchdog struct {
+	// the checks which must all pass
+	Checks []HealthCheck
+	// how often to check; when zero, half of $WATCHDOG_USEC, or one
+	// second without a watchdog
+	Interval time.Duration
+}
+
+// check and notify until `ctx` is done, returning its error
+func (wd *Watchdog) Run(ctx context.Context) error {
+	tick := time.NewTicker(wd.interval())
+	defer tick.Stop()
+
+	ready := false
+	for {
+		if err := wd.check(); err != nil {
+			Notify("STATUS=" + strings.Replace(err.Error(), "\n", " ", -1))
+		} else if !ready {
+			ready = true
+			Notify("READY=1\nSTATUS=healthy")
+		} else {
+			Notify("WATCHDOG=1\nSTATUS=healthy")
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// the first failing check, if any
+func (wd *Watchdog) check() error {
+	for _, check := range wd.Checks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (wd *Watchdog) interval() time.Duration {
+	if wd.Interval > 0 {
+		return wd.Interval
+	}
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		return time.Duration(usec) * time.Microsecond / 2
+	}
+	return time.Second
+}
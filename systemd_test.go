@@ -0,0 +1,50 @@
+package variant
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaxValue(t *testing.T) {
+	g := NewGauge("")
+	check := MaxValue("errors", g, 0.5)
+	if err := check(); err != nil {
+		t.Errorf("expected healthy, got %v", err)
+	}
+	g.Set(0.75)
+	if err := check(); err == nil || !strings.Contains(err.Error(), "errors") {
+		t.Errorf("expected an unhealthy error naming the stat, got %v", err)
+	}
+}
+
+func TestFresh(t *testing.T) {
+	g := NewGauge("")
+	check := Fresh("loop", g, time.Minute)
+	if err := check(); err == nil {
+		t.Errorf("expected a heartbeat at the epoch to be stale")
+	}
+	g.Set(float64(time.Now().Unix()))
+	if err := check(); err != nil {
+		t.Errorf("expected a fresh heartbeat, got %v", err)
+	}
+}
+
+func TestNotifyWithoutSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify("READY=1")
+	if sent || err != nil {
+		t.Errorf("expected nothing sent and no error, got %v %v", sent, err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "10000000")
+	if d := new(Watchdog).interval(); d != 5*time.Second {
+		t.Errorf("expected 5s, got %s", d)
+	}
+	t.Setenv("WATCHDOG_USEC", "")
+	if d := new(Watchdog).interval(); d != time.Second {
+		t.Errorf("expected 1s, got %s", d)
+	}
+}
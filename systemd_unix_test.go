@@ -0,0 +1,85 @@
+//go:build unix
+
+package variant
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// listen on a fresh NOTIFY_SOCKET, returning the messages received
+func listenNotify(t *testing.T) <-chan string {
+	addr := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", addr)
+
+	msgs := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			msgs <- string(buf[:n])
+		}
+	}()
+	return msgs
+}
+
+func next(t *testing.T, msgs <-chan string) string {
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no notification received")
+	}
+	return ""
+}
+
+func TestNotify(t *testing.T) {
+	msgs := listenNotify(t)
+	if sent, err := Notify("READY=1"); !sent || err != nil {
+		t.Fatalf("expected notification to be sent, got %v %v", sent, err)
+	}
+	if msg := next(t, msgs); msg != "READY=1" {
+		t.Errorf("expected READY=1, got %q", msg)
+	}
+}
+
+func TestWatchdogRun(t *testing.T) {
+	msgs := listenNotify(t)
+	g := NewGauge("")
+	g.Set(1)
+	wd := &Watchdog{
+		Checks:   []HealthCheck{MaxValue("errors", g, 0.5)},
+		Interval: time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- wd.Run(ctx) }()
+
+	if msg := next(t, msgs); msg != "STATUS=errors is 1.000000, above 0.500000" {
+		t.Errorf("expected an unhealthy status, got %q", msg)
+	}
+	g.Set(0)
+	msg := next(t, msgs)
+	for msg != "READY=1\nSTATUS=healthy" {
+		msg = next(t, msgs)
+	}
+	if msg := next(t, msgs); msg != "WATCHDOG=1\nSTATUS=healthy" {
+		t.Errorf("expected a watchdog ping, got %q", msg)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
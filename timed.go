@@ -0,0 +1,231 @@
+package variant
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// a value with the time it was recorded
+type TimedSample struct {
+	Time  time.Time
+	Value float64
+}
+
+// represents a moving average or percentile over the values recorded
+// in a trailing window of time, however many arrived in it
+// it is thread/goroutine safe
+//
+// Every sample in the window is kept, so memory grows with the update
+// rate times the window: 16 bytes a sample, about 10MB for 10k
+// updates a second over a minute. SetMaxSamples bounds it.
+type TimedMovingStat struct {
+	mutex      *sync.Mutex
+	window     time.Duration
+	samples    []TimedSample
+	head       int
+	max        int
+	percentile float64
+	ranked     bool
+	calculate  func(values []float64) float64
+	now        func() time.Time
+}
+
+// Create a new timed moving average expvar.Var. It will be published
+// under `name` and average the values recorded in the last `window`.
+//
+// An empty name will cause it to not be published.
+func NewTimedMovingAverage(name string, window time.Duration) *TimedMovingStat {
+	t := newTimedMovingStat(window)
+	t.calculate = mean
+	publish(name, t)
+	return t
+}
+
+// Create a new timed moving percentile expvar.Var. It will be
+// published under `name` and report the percentile of the values
+// recorded in the last `window`, e.g. p99 over the last minute.
+//
+// percentile must be between 0 and 1
+//
+// An empty name will cause it to not be published.
+func NewTimedMovingPercentile(name string, percentile float64, window time.Duration) *TimedMovingStat {
+	t := newTimedMovingStat(window)
+	t.percentile = percentile
+	t.ranked = true
+	t.calculate = func(values []float64) float64 {
+		if len(values) == 0 {
+			return 0.0
+		}
+		sort.Float64s(values)
+		return percentileOfSorted(values, t.percentile)
+	}
+	publish(name, t)
+	return t
+}
+
+func newTimedMovingStat(window time.Duration) *TimedMovingStat {
+	t := new(TimedMovingStat)
+	t.mutex = new(sync.Mutex)
+	t.window = window
+	t.now = time.Now
+	return t
+}
+
+// display the value as a string
+func (t *TimedMovingStat) String() string {
+	return formatFloat(t.Value())
+}
+
+// Append a new value to the stat, stamped with the current time
+func (t *TimedMovingStat) Update(val float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expire()
+	t.samples = append(t.samples, TimedSample{t.now(), val})
+	t.trim()
+}
+
+// Append several values to the stat, all stamped with the current time
+func (t *TimedMovingStat) UpdateBatch(vals []float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expire()
+	now := t.now()
+	for _, val := range vals {
+		t.samples = append(t.samples, TimedSample{now, val})
+	}
+	t.trim()
+}
+
+// Discard every value in the window
+func (t *TimedMovingStat) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.samples = nil
+	t.head = 0
+}
+
+// Keep at most `n` samples, dropping the oldest beyond that even if
+// they are still inside the window, so memory stays bounded under a
+// burst. An `n` less than 1 removes the limit, which is the default.
+func (t *TimedMovingStat) SetMaxSamples(n int) {
+	if n < 1 {
+		n = 0
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.max = n
+	t.trim()
+}
+
+// Change the percentile a percentile stat reports, keeping the values
+// already in the window. It has no effect on averages.
+//
+// percentile must be between 0 and 1, otherwise SetPercentile panics
+func (t *TimedMovingStat) SetPercentile(percentile float64) {
+	if !(percentile >= 0 && percentile <= 1) {
+		panic("variant: percentile must be between 0 and 1")
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.percentile = percentile
+}
+
+// obtain the percentile a percentile stat reports, and false for
+// averages
+func (t *TimedMovingStat) ReportedPercentile() (float64, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.percentile, t.ranked
+}
+
+// obtain the current value
+func (t *TimedMovingStat) Value() float64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expire()
+	return t.calculate(t.values())
+}
+
+// obtain a copy of the values in the window, oldest first
+func (t *TimedMovingStat) Values() []float64 {
+	samples := t.Samples()
+	values := make([]float64, len(samples))
+	for i, s := range samples {
+		values[i] = s.Value
+	}
+	return values
+}
+
+// obtain a copy of the values in the window with the time each was
+// recorded, oldest first
+func (t *TimedMovingStat) Samples() []TimedSample {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expire()
+	return append([]TimedSample(nil), t.samples[t.head:]...)
+}
+
+// a fresh copy of the values in the window, oldest first. Must be
+// called with the mutex held.
+func (t *TimedMovingStat) values() []float64 {
+	live := t.samples[t.head:]
+	values := make([]float64, len(live))
+	for i, s := range live {
+		values[i] = s.Value
+	}
+	return values
+}
+
+// drop samples older than the window. Must be called with the mutex
+// held.
+func (t *TimedMovingStat) expire() {
+	cutoff := t.now().Add(-t.window)
+	for t.head < len(t.samples) && !t.samples[t.head].Time.After(cutoff) {
+		t.head++
+	}
+	t.compact()
+}
+
+// drop the oldest samples beyond the limit set by SetMaxSamples. Must
+// be called with the mutex held.
+func (t *TimedMovingStat) trim() {
+	if live := len(t.samples) - t.head; t.max > 0 && live > t.max {
+		t.head += live - t.max
+	}
+	t.compact()
+}
+
+// move the live samples down to the start of the slice once the
+// expired ones before them outnumber them, so the backing array is
+// reused rather than creeping forward and growing. Each sample is
+// moved at most once per window's worth of expiries, keeping expiry
+// amortized O(1). Must be called with the mutex held.
+func (t *TimedMovingStat) compact() {
+	if t.head == 0 || t.head < len(t.samples)-t.head {
+		return
+	}
+	n := copy(t.samples, t.samples[t.head:])
+	t.samples = t.samples[:n]
+	t.head = 0
+}
+
+// check the samples are in time order and inside the window
+func (t *TimedMovingStat) Audit() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var problems []string
+	live := t.samples[t.head:]
+	for i := 1; i < len(live); i++ {
+		if live[i].Time.Before(live[i-1].Time) {
+			problems = append(problems, "samples are out of time order")
+			break
+		}
+	}
+	if !(t.percentile >= 0 && t.percentile <= 1) {
+		problems = append(problems, "percentile is outside [0, 1]")
+	}
+	return problems
+}
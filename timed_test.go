@@ -0,0 +1,141 @@
+package variant
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+)
+
+func newTestTimed(t *TimedMovingStat) (*TimedMovingStat, *fakeClock) {
+	clock := &fakeClock{time.Unix(1000, 0)}
+	t.now = clock.now
+	return t, clock
+}
+
+func TestTimedAsVar(t *testing.T) {
+	var _ expvar.Var = NewTimedMovingAverage("", time.Minute)
+}
+
+func TestTimedAverageExpires(t *testing.T) {
+	s, clock := newTestTimed(NewTimedMovingAverage("", time.Minute))
+	s.Update(10)
+	clock.advance(30 * time.Second)
+	s.Update(20)
+	if avg := s.Value(); avg != 15.0 {
+		t.Errorf("expected avg of 15.0, got %f", avg)
+	}
+
+	clock.advance(31 * time.Second)
+	if avg := s.Value(); avg != 20.0 {
+		t.Errorf("expected the first sample to expire, got avg %f", avg)
+	}
+	clock.advance(time.Minute)
+	if n := len(s.Values()); n != 0 {
+		t.Errorf("expected an empty window, got %d values", n)
+	}
+}
+
+func TestTimedPercentile(t *testing.T) {
+	s, clock := newTestTimed(NewTimedMovingPercentile("", 0.99, time.Minute))
+	for i := 1; i <= 100; i++ {
+		s.Update(float64(i))
+	}
+	if v := s.Value(); v != 100.0 {
+		t.Errorf("expected p99 of 100.0, got %f", v)
+	}
+	s.SetPercentile(0.5)
+	if v := s.Value(); v != 51.0 {
+		t.Errorf("expected p50 of 51.0, got %f", v)
+	}
+	clock.advance(2 * time.Minute)
+	if v := s.Value(); v != 0.0 {
+		t.Errorf("expected 0.0 for an empty window, got %f", v)
+	}
+}
+
+func TestTimedSamples(t *testing.T) {
+	s, clock := newTestTimed(NewTimedMovingAverage("", time.Minute))
+	s.Update(1)
+	clock.advance(time.Second)
+	s.UpdateBatch([]float64{2, 3})
+	samples := s.Samples()
+	if len(samples) != 3 || samples[0].Value != 1 || samples[2].Value != 3 {
+		t.Fatalf("expected samples 1, 2, 3, got %v", samples)
+	}
+	if !samples[1].Time.Equal(time.Unix(1001, 0)) {
+		t.Errorf("expected the batch to be stamped at 1001, got %s", samples[1].Time)
+	}
+	if problems := s.Audit(); len(problems) != 0 {
+		t.Errorf("unexpected findings %v", problems)
+	}
+	s.Reset()
+	if n := len(s.Values()); n != 0 {
+		t.Errorf("expected an empty window after Reset, got %d", n)
+	}
+}
+
+func TestDumpTimedSamples(t *testing.T) {
+	unregisterAfter(t, "test.dump.timed")
+	s := NewTimedMovingAverage("test.dump.timed", time.Minute)
+	s.Update(4)
+	rec := dump(&DumpHandler{Authorize: allowAll}, "test.dump.timed")
+	var body struct {
+		Samples []struct {
+			Time  time.Time
+			Value float64
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", rec.Body.String(), err)
+	}
+	if len(body.Samples) != 1 || body.Samples[0].Value != 4 || body.Samples[0].Time.IsZero() {
+		t.Errorf("expected one timestamped sample, got %+v", body.Samples)
+	}
+}
+
+func TestTimedSteadyTrafficStaysCompact(t *testing.T) {
+	s, clock := newTestTimed(NewTimedMovingAverage("", time.Second))
+	for i := 0; i < 100000; i++ {
+		clock.advance(time.Millisecond)
+		s.Update(float64(i % 10))
+	}
+	if live := len(s.Values()); live != 1000 {
+		t.Errorf("expected a second's 1000 samples, got %d", live)
+	}
+	if n := cap(s.samples); n > 4096 {
+		t.Errorf("expected the backing array to stay near the window, got capacity %d", n)
+	}
+	if avg := s.Value(); avg != 4.5 {
+		t.Errorf("expected avg of 4.5, got %f", avg)
+	}
+}
+
+func TestTimedMaxSamples(t *testing.T) {
+	s, _ := newTestTimed(NewTimedMovingPercentile("", 0.5, time.Minute))
+	s.SetMaxSamples(3)
+	s.UpdateBatch([]float64{9, 9, 1, 2, 3})
+	if vals := s.Values(); len(vals) != 3 || vals[0] != 1 {
+		t.Errorf("expected only the newest [1 2 3], got %v", vals)
+	}
+	if v := s.Value(); v != 2.0 {
+		t.Errorf("expected median of 2.0, got %f", v)
+	}
+	if vals := s.Values(); vals[0] != 1 || vals[2] != 3 {
+		t.Errorf("expected Value to leave the window in order, got %v", vals)
+	}
+}
+
+func BenchmarkTimedUpdateSteady(b *testing.B) {
+	s, clock := newTestTimed(NewTimedMovingAverage("", time.Minute))
+	// a full minute at 10k/s, then keep sliding
+	for i := 0; i < 600000; i++ {
+		clock.advance(100 * time.Microsecond)
+		s.Update(1)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clock.advance(100 * time.Microsecond)
+		s.Update(1)
+	}
+}
@@ -0,0 +1,82 @@
+package variant
+
+import (
+	"time"
+)
+
+// represents the latency of an operation, summarised over a size
+// bounded window of durations like a MovingSummary, and reported in a
+// fixed unit so every service publishing it agrees on what the numbers
+// mean
+// it is thread/goroutine safe
+type Timer struct {
+	unit    time.Duration
+	summary *MovingSummary
+	now     func() time.Time
+}
+
+// Create a new timer expvar.Var. It will be published under `name`
+// and maintain `size` durations, reported as multiples of `unit`, e.g.
+// time.Millisecond. It renders the same JSON object a MovingSummary
+// does; with no percentiles it reports p50, p95 and p99.
+//
+// unit must be positive and percentiles between 0 and 1
+//
+// An empty name will cause it to not be published.
+func NewTimer(name string, unit time.Duration, size int, percentiles ...float64) *Timer {
+	if unit <= 0 {
+		panic("variant: non-positive unit for NewTimer")
+	}
+	t := new(Timer)
+	t.unit = unit
+	t.summary = NewMovingSummary("", size, percentiles...)
+	t.now = time.Now
+	publish(name, t)
+	return t
+}
+
+// display the summary as a JSON object
+func (t *Timer) String() string {
+	return t.summary.String()
+}
+
+// Record how long `fn` takes to run
+func (t *Timer) Time(fn func()) {
+	start := t.now()
+	defer t.UpdateSince(start)
+	fn()
+}
+
+// Record the time elapsed since `start`
+func (t *Timer) UpdateSince(start time.Time) {
+	t.ObserveDuration(t.now().Sub(start))
+}
+
+// Record a duration
+func (t *Timer) ObserveDuration(d time.Duration) {
+	t.summary.Update(float64(d) / float64(t.unit))
+}
+
+// Discard every duration in the window
+func (t *Timer) Reset() {
+	t.summary.Reset()
+}
+
+// Change the percentiles the timer reports, keeping the durations
+// already in the window.
+//
+// percentiles must be between 0 and 1, otherwise SetPercentiles panics
+func (t *Timer) SetPercentiles(percentiles ...float64) {
+	t.summary.SetPercentiles(percentiles...)
+}
+
+// obtain the durations in the window, oldest first, in the timer's
+// unit
+func (t *Timer) Values() []float64 {
+	return t.summary.Values()
+}
+
+// compute every figure over the current window, in the timer's unit
+func (t *Timer) Summary() Summary {
+	return t.summary.Summary()
+}
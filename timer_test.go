@@ -0,0 +1,51 @@
+package variant
+
+import (
+	"expvar"
+	"testing"
+	"time"
+)
+
+func TestTimerAsVar(t *testing.T) {
+	var _ expvar.Var = NewTimer("", time.Millisecond, 3)
+}
+
+func TestTimerUnits(t *testing.T) {
+	tm := NewTimer("", time.Millisecond, 10, 0.5)
+	tm.ObserveDuration(1500 * time.Microsecond)
+	tm.ObserveDuration(2 * time.Second)
+	if vals := tm.Values(); len(vals) != 2 || vals[0] != 1.5 || vals[1] != 2000 {
+		t.Errorf("expected [1.5 2000] milliseconds, got %v", vals)
+	}
+
+	us := NewTimer("", time.Microsecond, 10)
+	us.ObserveDuration(time.Millisecond)
+	if vals := us.Values(); len(vals) != 1 || vals[0] != 1000 {
+		t.Errorf("expected [1000] microseconds, got %v", vals)
+	}
+}
+
+func TestTimerTime(t *testing.T) {
+	clock := &fakeClock{time.Unix(1000, 0)}
+	tm := NewTimer("", time.Millisecond, 10)
+	tm.now = clock.now
+
+	tm.Time(func() { clock.advance(25 * time.Millisecond) })
+	start := clock.now()
+	clock.advance(75 * time.Millisecond)
+	tm.UpdateSince(start)
+
+	sum := tm.Summary()
+	if sum.Count != 2 || sum.Min != 25 || sum.Max != 75 || sum.Mean != 50 {
+		t.Errorf("expected 25ms and 75ms, got %+v", sum)
+	}
+}
+
+func TestTimerRejectsBadUnit(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected NewTimer to panic on a zero unit")
+		}
+	}()
+	NewTimer("", 0, 10)
+}
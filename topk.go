@@ -0,0 +1,192 @@
+package variant
+
+import (
+	"container/heap"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a key a TopK is tracking, with an upper bound on how often it was
+// seen and by how much that may overstate it
+type TopKEntry struct {
+	Key   string
+	Count int64
+	// the most Count may overstate the true count by
+	Error int64
+}
+
+// a tracked key and its place in the heap
+type topCounter struct {
+	TopKEntry
+	index int
+}
+
+// a min-heap on count, so the counter to replace is always first
+type topHeap []*topCounter
+
+func (h topHeap) Len() int           { return len(h) }
+func (h topHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h topHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *topHeap) Push(x interface{}) {
+	c := x.(*topCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+func (h *topHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// represents the most frequent keys seen, such as endpoints or client
+// addresses, in memory bounded however many distinct keys there are.
+// It uses the space-saving algorithm (Metwally et al.): a fixed number
+// of counters, where an unseen key takes over the smallest counter
+// and inherits its count as possible error. Any key seen more than
+// total/capacity times is guaranteed to be tracked.
+// it is thread/goroutine safe
+type TopK struct {
+	mutex    *sync.Mutex
+	n        int
+	capacity int
+	total    int64
+	counters map[string]*topCounter
+	heap     topHeap
+}
+
+// Create a new top-k expvar.Var. It will be published under `name`
+// and report the `n` most frequent keys, tracking `capacity`
+// candidates to do so; a few times `n` makes the top `n` reliable. It
+// renders as a JSON array, most frequent first, such as
+//
+//	[{"key":"/users","count":120,"error":0},{"key":"/login","count":31,"error":2}]
+//
+// n must be positive; a capacity below n is raised to n.
+//
+// An empty name will cause it to not be published.
+func NewTopK(name string, n, capacity int) *TopK {
+	if n <= 0 {
+		panic("variant: non-positive n for NewTopK")
+	}
+	if capacity < n {
+		capacity = n
+	}
+	t := new(TopK)
+	t.mutex = new(sync.Mutex)
+	t.n = n
+	t.capacity = capacity
+	t.counters = make(map[string]*topCounter, capacity)
+	t.heap = make(topHeap, 0, capacity)
+	publish(name, t)
+	return t
+}
+
+// display the top keys as a JSON array
+func (t *TopK) String() string {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, e := range t.Top() {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(`{"key":`)
+		b.WriteString(strconv.Quote(e.Key))
+		b.WriteString(`,"count":`)
+		b.WriteString(strconv.FormatInt(e.Count, 10))
+		b.WriteString(`,"error":`)
+		b.WriteString(strconv.FormatInt(e.Error, 10))
+		b.WriteString("}")
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// Count one occurrence of `key`
+func (t *TopK) Observe(key string) {
+	t.ObserveN(key, 1)
+}
+
+// Count `n` occurrences of `key`
+func (t *TopK) ObserveN(key string, n int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.total += n
+
+	if c, ok := t.counters[key]; ok {
+		c.Count += n
+		heap.Fix(&t.heap, c.index)
+		return
+	}
+	if len(t.heap) < t.capacity {
+		c := &topCounter{TopKEntry: TopKEntry{Key: key, Count: n}}
+		heap.Push(&t.heap, c)
+		t.counters[key] = c
+		return
+	}
+
+	// take over the smallest counter
+	c := t.heap[0]
+	delete(t.counters, c.Key)
+	c.Error = c.Count
+	c.Count += n
+	c.Key = key
+	t.counters[key] = c
+	heap.Fix(&t.heap, 0)
+}
+
+// obtain the top keys, most frequent first
+func (t *TopK) Top() []TopKEntry {
+	t.mutex.Lock()
+	entries := make([]TopKEntry, len(t.heap))
+	for i, c := range t.heap {
+		entries[i] = c.TopKEntry
+	}
+	t.mutex.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if len(entries) > t.n {
+		entries = entries[:t.n]
+	}
+	return entries
+}
+
+// Forget every key
+func (t *TopK) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.total = 0
+	t.counters = make(map[string]*topCounter, t.capacity)
+	t.heap = t.heap[:0]
+}
+
+// render the top keys as JSON, the same as String
+func (t *TopK) MarshalJSON() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// take a copy of the top keys. Count is every occurrence observed, and
+// Fields hold the count of each top key.
+func (t *TopK) Snapshot() Snapshot {
+	top := t.Top()
+	fields := make(map[string]float64, len(top))
+	for _, e := range top {
+		fields[e.Key] = float64(e.Count)
+	}
+	t.mutex.Lock()
+	total := t.total
+	t.mutex.Unlock()
+	return Snapshot{Time: time.Now(), Count: total, Fields: fields}
+}
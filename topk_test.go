@@ -0,0 +1,73 @@
+package variant
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"testing"
+)
+
+func TestTopKAsVar(t *testing.T) {
+	var _ expvar.Var = NewTopK("", 3, 10)
+}
+
+func TestTopKExact(t *testing.T) {
+	k := NewTopK("", 2, 10)
+	for i := 0; i < 5; i++ {
+		k.Observe("/users")
+	}
+	k.ObserveN("/login", 3)
+	k.Observe("/health")
+
+	want := `[{"key":"/users","count":5,"error":0},{"key":"/login","count":3,"error":0}]`
+	if got := k.String(); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestTopKHeavyHitters(t *testing.T) {
+	k := NewTopK("", 3, 20)
+	// three heavy keys buried in a long tail of distinct ones
+	for i := 0; i < 10000; i++ {
+		switch i % 10 {
+		case 0, 1, 2:
+			k.Observe("a")
+		case 3, 4:
+			k.Observe("b")
+		case 5:
+			k.Observe("c")
+		default:
+			k.Observe(fmt.Sprintf("tail-%d", i))
+		}
+	}
+	top := k.Top()
+	if len(top) != 3 || top[0].Key != "a" || top[1].Key != "b" || top[2].Key != "c" {
+		t.Fatalf("expected a, b, c, got %v", top)
+	}
+	for i, actual := range []int64{3000, 2000, 1000} {
+		if e := top[i]; e.Count < actual || e.Count-e.Error > actual {
+			t.Errorf("expected %s's bounds to contain %d, got %+v", e.Key, actual, e)
+		}
+	}
+	if n := len(k.counters); n > 20 {
+		t.Errorf("expected at most 20 counters, got %d", n)
+	}
+
+	var body []map[string]interface{}
+	if err := json.Unmarshal([]byte(k.String()), &body); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	k.Reset()
+	if top := k.Top(); len(top) != 0 {
+		t.Errorf("expected nothing after Reset, got %v", top)
+	}
+}
+
+func TestTopKRejectsBadN(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected NewTopK to panic on a zero n")
+		}
+	}()
+	NewTopK("", 0, 10)
+}
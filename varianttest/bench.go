@@ -0,0 +1,66 @@
+/*
+Package varianttest provides helpers for using variant stats in tests
+and benchmarks.
+*/
+package varianttest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brianm/variant"
+)
+
+// the most iteration times Run keeps, so memory stays bounded however
+// large b.N grows for a cheap body
+const maxSamples = 1 << 16
+
+// Run `f` b.N times, timing every iteration, and report the mean, p50,
+// and p99 iteration time in nanoseconds with b.ReportMetric alongside
+// allocations per op. The figures are computed by the same
+// SimpleMovingStat code production stats use, and the iteration times
+// are also fed to `stats`, so a benchmark can exercise the exact stat
+// definitions a service publishes.
+//
+// Only the latest 65536 iteration times are kept, like a production
+// window; the mean and percentiles, and what `stats` receive, cover
+// those.
+//
+// Timing each iteration adds the cost of two clock reads to every op,
+// so very small bodies will look slower than with a plain b.N loop.
+func Run(b *testing.B, f func(), stats ...variant.Updater) {
+	b.ReportAllocs()
+	samples := make([]float64, min(b.N, maxSamples))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		f()
+		samples[i%len(samples)] = float64(time.Since(start).Nanoseconds())
+	}
+	b.StopTimer()
+
+	// oldest first, for stats which care about order
+	split := b.N % len(samples)
+	samples = append(samples[split:], samples[:split]...)
+
+	for _, s := range stats {
+		if batch, ok := s.(variant.BatchUpdater); ok {
+			batch.UpdateBatch(samples)
+			continue
+		}
+		for _, d := range samples {
+			s.Update(d)
+		}
+	}
+
+	mean := variant.NewSimpleMovingAverage("", len(samples))
+	mean.UpdateBatch(samples)
+	b.ReportMetric(mean.Value(), "mean-ns")
+
+	pct := variant.NewSimpleMovingPercentile("", 0.50, len(samples))
+	pct.UpdateBatch(samples)
+	b.ReportMetric(pct.Value(), "p50-ns")
+	pct.SetPercentile(0.99)
+	b.ReportMetric(pct.Value(), "p99-ns")
+}
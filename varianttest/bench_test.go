@@ -0,0 +1,37 @@
+package varianttest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brianm/variant"
+)
+
+func TestRunReportsMetrics(t *testing.T) {
+	result := testing.Benchmark(func(b *testing.B) {
+		Run(b, func() {
+			time.Sleep(time.Microsecond)
+		})
+	})
+	for _, unit := range []string{"mean-ns", "p50-ns", "p99-ns"} {
+		if v, ok := result.Extra[unit]; !ok || v < 1000 {
+			t.Errorf("expected %s of at least 1000, got %f (reported=%v)", unit, v, ok)
+		}
+	}
+	if result.Extra["p99-ns"] < result.Extra["p50-ns"] {
+		t.Errorf("expected p99 >= p50, got %v", result.Extra)
+	}
+}
+
+func TestRunFeedsStats(t *testing.T) {
+	latency := variant.NewSimpleMovingAverage("", 1000000)
+	iterations := 0
+	testing.Benchmark(func(b *testing.B) {
+		latency.Reset()
+		Run(b, func() {}, latency)
+		iterations = b.N
+	})
+	if n := len(latency.Values()); n != min(iterations, maxSamples) {
+		t.Errorf("expected %d samples, got %d", min(iterations, maxSamples), n)
+	}
+}
@@ -0,0 +1,144 @@
+package variant
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how many buckets a WindowedCounter divides its window into
+const windowedBuckets = 60
+
+// a span of time a WindowedCounter counts in, identified by how many
+// bucket widths have passed since the Unix epoch
+type windowedBucket struct {
+	epoch int64
+	count int64
+}
+
+// represents a count of events, both in total and over a trailing
+// window of time, e.g. errors in the last five minutes. The window is
+// divided into sixty buckets, so events leave it a bucket at a time as
+// it slides: the windowed count covers between 59/60ths of the window
+// and all of it.
+// it is thread/goroutine safe
+type WindowedCounter struct {
+	mutex   *sync.Mutex
+	window  time.Duration
+	width   int64
+	total   int64
+	buckets [windowedBuckets]windowedBucket
+	now     func() time.Time
+}
+
+// the counts of a WindowedCounter at one moment
+type WindowedCount struct {
+	// every event ever counted
+	Total int64
+	// the events in the trailing window
+	Count int64
+	// Count per second of the window
+	Rate float64
+}
+
+// Create a new windowed counter expvar.Var. It will be published
+// under `name` and count events over the trailing `window`, rendering
+// as a JSON object such as
+//
+//	{"total":1200,"count":30,"rate":0.100000}
+//
+// Like time.NewTicker, it panics if `window` is not positive.
+//
+// An empty name will cause it to not be published.
+func NewWindowedCounter(name string, window time.Duration) *WindowedCounter {
+	if window <= 0 {
+		panic("variant: non-positive interval for NewWindowedCounter")
+	}
+	c := new(WindowedCounter)
+	c.mutex = new(sync.Mutex)
+	c.window = window
+	c.width = int64(window) / windowedBuckets
+	if c.width == 0 {
+		c.width = 1
+	}
+	c.now = time.Now
+	publish(name, c)
+	return c
+}
+
+// display the counts as a JSON object
+func (c *WindowedCounter) String() string {
+	counts := c.Counts()
+
+	var b strings.Builder
+	b.WriteString(`{"total":`)
+	b.WriteString(strconv.FormatInt(counts.Total, 10))
+	b.WriteString(`,"count":`)
+	b.WriteString(strconv.FormatInt(counts.Count, 10))
+	b.WriteString(`,"rate":`)
+	b.WriteString(formatFloat(counts.Rate))
+	b.WriteString("}")
+	return b.String()
+}
+
+// count `delta` events, which may be negative to correct an earlier
+// count
+func (c *WindowedCounter) Incr(delta int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	epoch := c.now().UnixNano() / c.width
+	bucket := &c.buckets[epoch%windowedBuckets]
+	if bucket.epoch != epoch {
+		*bucket = windowedBucket{epoch: epoch}
+	}
+	bucket.count += delta
+	c.total += delta
+}
+
+// obtain the total and windowed counts
+func (c *WindowedCounter) Counts() WindowedCount {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	epoch := c.now().UnixNano() / c.width
+	counts := WindowedCount{Total: c.total}
+	for _, bucket := range c.buckets {
+		if bucket.epoch > epoch-windowedBuckets && bucket.epoch <= epoch {
+			counts.Count += bucket.count
+		}
+	}
+	counts.Rate = float64(counts.Count) / c.window.Seconds()
+	return counts
+}
+
+// obtain the number of events in the trailing window
+func (c *WindowedCounter) Value() int64 {
+	return c.Counts().Count
+}
+
+// Discard every count, the total included
+func (c *WindowedCounter) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.total = 0
+	c.buckets = [windowedBuckets]windowedBucket{}
+}
+
+// render the counts as JSON, the same as String
+func (c *WindowedCounter) MarshalJSON() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// take a copy of the counts. Count is the windowed count, and Fields
+// hold "total" and "rate".
+func (c *WindowedCounter) Snapshot() Snapshot {
+	counts := c.Counts()
+	return Snapshot{
+		Time:   c.now(),
+		Count:  counts.Count,
+		Value:  float64(counts.Count),
+		Fields: map[string]float64{"total": float64(counts.Total), "rate": counts.Rate},
+	}
+}
@@ -0,0 +1,65 @@
+package variant
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+	"time"
+)
+
+func newTestWindowed(window time.Duration) (*WindowedCounter, *fakeClock) {
+	clock := &fakeClock{time.Unix(1000, 0)}
+	c := NewWindowedCounter("", window)
+	c.now = clock.now
+	return c, clock
+}
+
+func TestWindowedCounterAsVar(t *testing.T) {
+	var _ expvar.Var = NewWindowedCounter("", time.Minute)
+}
+
+func TestWindowedCounterSlides(t *testing.T) {
+	c, clock := newTestWindowed(5 * time.Minute)
+	c.Incr(10)
+	clock.advance(3 * time.Minute)
+	c.Incr(20)
+
+	counts := c.Counts()
+	if counts.Total != 30 || counts.Count != 30 || counts.Rate != 0.1 {
+		t.Errorf("expected 30 in the window at 0.1/s, got %+v", counts)
+	}
+
+	clock.advance(3 * time.Minute)
+	if counts := c.Counts(); counts.Total != 30 || counts.Count != 20 {
+		t.Errorf("expected the first 10 to leave the window, got %+v", counts)
+	}
+	clock.advance(time.Hour)
+	if n := c.Value(); n != 0 {
+		t.Errorf("expected an empty window, got %d", n)
+	}
+}
+
+func TestWindowedCounterString(t *testing.T) {
+	c, _ := newTestWindowed(10 * time.Second)
+	c.Incr(5)
+	var body map[string]float64
+	if err := json.Unmarshal([]byte(c.String()), &body); err != nil {
+		t.Fatalf("invalid json %q: %v", c.String(), err)
+	}
+	if body["total"] != 5 || body["count"] != 5 || body["rate"] != 0.5 {
+		t.Errorf("unexpected counts %v", body)
+	}
+	c.Reset()
+	if counts := c.Counts(); counts.Total != 0 || counts.Count != 0 {
+		t.Errorf("expected nothing after Reset, got %+v", counts)
+	}
+}
+
+func TestWindowedCounterRejectsBadWindow(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected NewWindowedCounter to panic on a zero window")
+		}
+	}()
+	NewWindowedCounter("", 0)
+}